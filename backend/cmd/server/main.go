@@ -2,8 +2,11 @@ package main
 
 import (
 	"bstock/database"
+	"bstock/events"
 	"bstock/models"
 	"bstock/routes"
+	"bstock/storage"
+	"context"
 	"github.com/gin-gonic/gin"
 	"log"
 	"os"
@@ -53,9 +56,9 @@ func main() {
 		gin.SetMode(ginMode)
 	}
 
-	// Create uploads directory
-	if err := os.MkdirAll("./uploads", 0755); err != nil {
-		log.Fatal("Failed to create uploads directory:", err)
+	// Configure file storage (creates the uploads directory for local storage)
+	if err := storage.Setup(); err != nil {
+		log.Fatal("Failed to configure storage:", err)
 	}
 
 	// Connect to database
@@ -69,16 +72,62 @@ func main() {
 		&models.Organization{},
 		&models.OrganizationUser{},
 		&models.Plan{},
+		&models.Location{},
 		&models.Subscription{},
 		&models.Product{},
 		&models.Variant{},
+		&models.ProductAttribute{},
+		&models.StockLevel{},
+		&models.Barcode{},
+		&models.PackUnit{},
+		&models.ProductImage{},
+		&models.ScaleBarcodeFormat{},
 		&models.Vendor{},
 		&models.Sale{},
 		&models.SaleItem{},
+		&models.StockMovement{},
+		&models.CostLayer{},
+		&models.StockConflict{},
+		&models.SaleReturn{},
+		&models.SaleReturnItem{},
+		&models.StockTransfer{},
+		&models.StockTransferItem{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderLine{},
+		&models.GoodsReceipt{},
+		&models.GoodsReceiptItem{},
+		&models.Stocktake{},
+		&models.StocktakeItem{},
+		&models.Tombstone{},
 	); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	if err := database.EnableRowLevelSecurity(database.DB); err != nil {
+		log.Fatal("Failed to enable row level security:", err)
+	}
+	if err := database.BackfillLocations(database.DB); err != nil {
+		log.Fatal("Failed to backfill locations:", err)
+	}
+	if err := database.BackfillCostLayers(database.DB); err != nil {
+		log.Fatal("Failed to backfill cost layers:", err)
+	}
+	if err := database.BackfillPaymentProofKeys(database.DB); err != nil {
+		log.Fatal("Failed to backfill payment proof keys:", err)
+	}
+	if err := database.BackfillSaleSyncFlag(database.DB); err != nil {
+		log.Fatal("Failed to backfill sale sync flag:", err)
+	}
+	if err := database.BackfillArchiveStatus(database.DB); err != nil {
+		log.Fatal("Failed to backfill archive status:", err)
+	}
+	if err := database.BackfillSearchText(database.DB); err != nil {
+		log.Fatal("Failed to backfill search text:", err)
+	}
+	if err := database.EnsureSearchIndexes(database.DB); err != nil {
+		log.Fatal("Failed to create search indexes:", err)
+	}
+
 	// Seed database
 	if err := database.SeedDatabase(database.DB); err != nil {
 		log.Fatal("Failed to seed database:", err)
@@ -86,6 +135,9 @@ func main() {
 
 	log.Println("✅ Database migrated and seeded successfully")
 
+	// Relay stock and catalog events between server instances and connected terminals
+	go events.Listen(context.Background(), database.DSN())
+
 	// Setup Gin router
 	r := gin.Default()
 	r.Use(gin.Recovery())
@@ -11,8 +11,9 @@ import (
 
 var DB *gorm.DB
 
-func Connect() error {
-	dsn := fmt.Sprintf(
+// DSN returns the connection string for the configured database
+func DSN() string {
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
 		getEnv("DB_HOST", "localhost"),
 		getEnv("DB_USER", "postgres"),
@@ -20,9 +21,11 @@ func Connect() error {
 		getEnv("DB_NAME", "bstock"),
 		getEnv("DB_PORT", "5432"),
 	)
+}
 
+func Connect() error {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = gorm.Open(postgres.Open(DSN()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"bstock/models"
+	"bstock/utils"
+	_ "embed"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+//go:embed rls_policies.sql
+var rowLevelSecurity string
+
+// EnableRowLevelSecurity applies rls_policies.sql. The tables must exist, so it runs after AutoMigrate.
+// Safe to run on every start.
+func EnableRowLevelSecurity(db *gorm.DB) error {
+	var lines []string
+	for _, line := range strings.Split(rowLevelSecurity, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillLocations gives organizations created before multi-location support a default
+// location and moves their existing stock and sales onto it. It also enforces one default
+// location per organization. Safe to run on every start.
+func BackfillLocations(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO locations (id, organization_id, name, is_default, created_at, updated_at)
+			SELECT uuid_generate_v4(), organizations.id, 'Main Store', true, NOW(), NOW()
+			FROM organizations
+			WHERE NOT EXISTS (
+				SELECT 1 FROM locations WHERE locations.organization_id = organizations.id
+			)
+		`).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO stock_levels (id, variant_id, location_id, quantity, created_at, updated_at)
+			SELECT uuid_generate_v4(), variants.id, locations.id, variants.quantity, NOW(), NOW()
+			FROM variants
+			JOIN products ON products.id = variants.product_id
+			JOIN locations ON locations.organization_id = products.organization_id AND locations.is_default
+			WHERE NOT EXISTS (
+				SELECT 1 FROM stock_levels WHERE stock_levels.variant_id = variants.id
+			)
+		`).Error; err != nil {
+			return err
+		}
+
+		// Keep the oldest default where concurrent requests created more than one, then make sure
+		// an organization can never have two
+		if err := tx.Exec(`
+			UPDATE locations SET is_default = false
+			WHERE is_default AND id <> (
+				SELECT first.id FROM locations first
+				WHERE first.organization_id = locations.organization_id AND first.is_default
+				ORDER BY first.created_at, first.id
+				LIMIT 1
+			)
+		`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_org_default ON locations (organization_id) WHERE is_default
+		`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+			UPDATE sales SET location_id = locations.id
+			FROM locations
+			WHERE sales.location_id IS NULL
+			  AND locations.organization_id = sales.organization_id
+			  AND locations.is_default
+		`).Error
+	})
+}
+
+// BackfillCostLayers opens a cost layer at the current purchase price for stock that was on hand
+// before cost layers were tracked, so FIFO costing has something to consume. Safe to run on every start.
+func BackfillCostLayers(db *gorm.DB) error {
+	return db.Exec(`
+		INSERT INTO cost_layers (id, organization_id, variant_id, quantity_received, quantity_remaining, unit_cost, source_type, created_at, updated_at)
+		SELECT uuid_generate_v4(), products.organization_id, variants.id, variants.quantity, variants.quantity, variants.purchase_price, 'adjustment', NOW(), NOW()
+		FROM variants
+		JOIN products ON products.id = variants.product_id
+		WHERE variants.quantity > 0
+		  AND NOT EXISTS (
+			SELECT 1 FROM cost_layers WHERE cost_layers.variant_id = variants.id
+		  )
+	`).Error
+}
+
+// BackfillPaymentProofKeys moves payment proofs saved as "./uploads/<file>" paths, before file storage
+// existed, to storage keys relative to the local uploads directory. Safe to run on every start.
+func BackfillPaymentProofKeys(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("sales", "payment_proof_url") {
+		return nil
+	}
+	return db.Exec(`
+		UPDATE sales SET payment_proof_key = regexp_replace(payment_proof_url, '^(\./)?uploads/', '')
+		WHERE COALESCE(payment_proof_key, '') = ''
+		  AND COALESCE(payment_proof_url, '') <> ''
+	`).Error
+}
+
+// BackfillSaleSyncFlag clears is_synced on sales made online, which used to default to true.
+// Only sales uploaded from a device through POST /sales/sync are synced. Safe to run on every start.
+func BackfillSaleSyncFlag(db *gorm.DB) error {
+	return db.Exec(`UPDATE sales SET is_synced = false WHERE is_synced AND client_sale_id IS NULL`).Error
+}
+
+// BackfillArchiveStatus makes status the single source of truth for archiving: variants archived
+// before lifecycle statuses existed get the archived status, archived_at is filled or cleared to
+// match, and a check constraint keeps the two in step from then on. Safe to run on every start.
+func BackfillArchiveStatus(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE variants SET status = 'archived'
+			WHERE archived_at IS NOT NULL AND status <> 'archived'
+		`).Error; err != nil {
+			return err
+		}
+
+		for _, table := range []string{"products", "variants"} {
+			if err := tx.Exec(`UPDATE ` + table + ` SET archived_at = updated_at WHERE status = 'archived' AND archived_at IS NULL`).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`UPDATE ` + table + ` SET archived_at = NULL WHERE status <> 'archived' AND archived_at IS NOT NULL`).Error; err != nil {
+				return err
+			}
+
+			constraint := "chk_" + table + "_archived_at"
+			if tx.Migrator().HasConstraint(table, constraint) {
+				continue
+			}
+			if err := tx.Exec(`ALTER TABLE ` + table + ` ADD CONSTRAINT ` + constraint +
+				` CHECK ((status = 'archived') = (archived_at IS NOT NULL))`).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EnsureSearchIndexes enables pg_trgm and creates the trigram indexes fuzzy product search relies on.
+// Safe to run on every start.
+func EnsureSearchIndexes(db *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_name_trgm ON products USING gin (search_name gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_text_trgm ON products USING gin (search_text gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_variants_search_text_trgm ON variants USING gin (search_text gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_barcodes_code_trgm ON barcodes USING gin (code gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillSearchText fills the search columns of products and variants saved before fuzzy search
+// existed. Safe to run on every start.
+func BackfillSearchText(db *gorm.DB) error {
+	var products []models.Product
+	if err := db.Where("search_name = '' AND name <> ''").FindInBatches(&products, 500, func(tx *gorm.DB, batch int) error {
+		for _, product := range products {
+			if err := tx.Model(&models.Product{}).Where("id = ?", product.ID).UpdateColumns(map[string]interface{}{
+				"search_name": utils.SearchText(product.Name),
+				"search_text": utils.SearchText(product.Category, product.Description),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error; err != nil {
+		return err
+	}
+
+	var variants []models.Variant
+	return db.Where("search_text = '' AND sku <> ''").FindInBatches(&variants, 500, func(tx *gorm.DB, batch int) error {
+		for _, variant := range variants {
+			variant.RefreshSearchText()
+			if err := tx.Model(&models.Variant{}).Where("id = ?", variant.ID).UpdateColumn("search_text", variant.SearchText).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
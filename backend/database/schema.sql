@@ -1,137 +1,12 @@
--- Enable UUID extension
+-- Superseded: on startup the server creates and migrates every table with GORM's AutoMigrate
+-- (cmd/server/main.go), applies rls_policies.sql, then runs the database.Backfill* and Ensure*
+-- steps. Do not add tables here; change the models in models/ instead.
+--
+-- This file only enables the extensions those migrations rely on. It is mounted into
+-- docker-entrypoint-initdb.d so the server's database role doesn't need to create them.
+
+-- Primary keys default to uuid_generate_v4()
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
--- Table: organizations
-CREATE TABLE organizations (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    name VARCHAR(255) UNIQUE NOT NULL,
-    owner_id UUID NOT NULL,
-    subscription_id UUID,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: users
-CREATE TABLE users (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    phone_number VARCHAR(20) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: organization_users (join table)
-CREATE TABLE organization_users (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-    role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'cashier')),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, organization_id)
-);
-
--- Table: plans
-CREATE TABLE plans (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    name VARCHAR(50) UNIQUE NOT NULL,
-    price_monthly DECIMAL(10,2) NOT NULL,
-    product_limit INTEGER,
-    user_limit INTEGER,
-    location_limit INTEGER,
-    analytics_enabled BOOLEAN NOT NULL DEFAULT FALSE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: subscriptions
-CREATE TABLE subscriptions (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    organization_id UUID UNIQUE NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-    plan_id UUID NOT NULL REFERENCES plans(id),
-    status VARCHAR(20) NOT NULL CHECK (status IN ('active', 'trial', 'canceled')),
-    current_period_end TIMESTAMP,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: vendors
-CREATE TABLE vendors (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-    name VARCHAR(255) NOT NULL,
-    contact_info TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: products
-CREATE TABLE products (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-    name VARCHAR(255) NOT NULL,
-    description TEXT,
-    category VARCHAR(100),
-    image_url VARCHAR(500),
-    vendor_id UUID REFERENCES vendors(id) ON DELETE SET NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: variants
-CREATE TABLE variants (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
-    attributes JSONB DEFAULT '{}',
-    sku VARCHAR(100) NOT NULL,
-    purchase_price DECIMAL(10,2) NOT NULL DEFAULT 0,
-    sale_price DECIMAL(10,2) NOT NULL,
-    quantity INTEGER NOT NULL DEFAULT 0,
-    min_stock_level INTEGER DEFAULT 0,
-    unit_type VARCHAR(20) DEFAULT 'pcs',
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(product_id, sku)
-);
-
--- Table: sales
-CREATE TABLE sales (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-    user_id UUID NOT NULL REFERENCES users(id),
-    total_amount DECIMAL(10,2) NOT NULL,
-    total_profit DECIMAL(10,2) NOT NULL,
-    payment_method VARCHAR(50) NOT NULL,
-    payment_proof_url VARCHAR(500),
-    is_synced BOOLEAN NOT NULL DEFAULT TRUE,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Table: sale_items
-CREATE TABLE sale_items (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    sale_id UUID NOT NULL REFERENCES sales(id) ON DELETE CASCADE,
-    variant_id UUID NOT NULL REFERENCES variants(id),
-    quantity INTEGER NOT NULL,
-    price_at_sale DECIMAL(10,2) NOT NULL,
-    purchase_price_at_sale DECIMAL(10,2) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
--- Add foreign key constraint to organizations
-ALTER TABLE organizations ADD CONSTRAINT fk_organizations_owner
-    FOREIGN KEY (owner_id) REFERENCES users(id);
-
-ALTER TABLE organizations ADD CONSTRAINT fk_organizations_subscription
-    FOREIGN KEY (subscription_id) REFERENCES subscriptions(id);
-
--- Create indexes for performance
-CREATE INDEX idx_organization_users_org ON organization_users(organization_id);
-CREATE INDEX idx_organization_users_user ON organization_users(user_id);
-CREATE INDEX idx_products_org ON products(organization_id);
-CREATE INDEX idx_variants_product ON variants(product_id);
-CREATE INDEX idx_sales_org ON sales(organization_id);
-CREATE INDEX idx_sales_created ON sales(created_at);
-CREATE INDEX idx_sale_items_sale ON sale_items(sale_id);
-CREATE INDEX idx_vendors_org ON vendors(organization_id);
+-- Fuzzy product search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
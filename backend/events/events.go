@@ -0,0 +1,111 @@
+package events
+
+import (
+	"bstock/models"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Event types pushed to connected terminals
+const (
+	TypeStockChanged   = "stock.changed"
+	TypeCatalogChanged = "catalog.changed"
+)
+
+// Catalog change actions
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// channel is the Postgres NOTIFY channel events travel on between server instances
+const channel = "bstock_events"
+
+// Event is a change pushed to an organization's connected terminals. Events with a location
+// only reach terminals watching that location or all of them.
+type Event struct {
+	Type           string          `json:"type"`
+	OrganizationID uuid.UUID       `json:"organization_id"`
+	LocationID     *uuid.UUID      `json:"location_id,omitempty"`
+	Data           json.RawMessage `json:"data"`
+	At             time.Time       `json:"at"`
+}
+
+// StockChanged is the data of a stock.changed event
+type StockChanged struct {
+	VariantID     uuid.UUID `json:"variant_id"`
+	ProductID     uuid.UUID `json:"product_id"`
+	LocationID    uuid.UUID `json:"location_id"`
+	Quantity      float64   `json:"quantity"`       // Balance at the location
+	TotalQuantity float64   `json:"total_quantity"` // Balance across all locations
+}
+
+// CatalogChanged is the data of a catalog.changed event. Terminals pull the details with catalog sync.
+type CatalogChanged struct {
+	Entity    string     `json:"entity"` // product, variant or catalog for bulk changes such as imports
+	ID        *uuid.UUID `json:"id,omitempty"`
+	ProductID *uuid.UUID `json:"product_id,omitempty"`
+	Action    string     `json:"action"`
+	Status    string     `json:"status,omitempty"`
+	SalePrice *float64   `json:"sale_price,omitempty"` // Set for variants, so terminals can reprice without a sync
+}
+
+// Publish queues an event for delivery when tx commits; it is dropped if tx rolls back.
+// Outside a transaction it is delivered straight away.
+func Publish(tx *gorm.DB, eventType string, orgID uuid.UUID, locationID *uuid.UUID, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(Event{
+		Type:           eventType,
+		OrganizationID: orgID,
+		LocationID:     locationID,
+		Data:           raw,
+		At:             time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", channel, string(payload)).Error
+}
+
+// PublishStock announces a variant's new balance at a location
+func PublishStock(tx *gorm.DB, orgID uuid.UUID, change StockChanged) error {
+	return Publish(tx, TypeStockChanged, orgID, &change.LocationID, change)
+}
+
+// PublishCatalog announces a catalog edit
+func PublishCatalog(tx *gorm.DB, orgID uuid.UUID, change CatalogChanged) error {
+	return Publish(tx, TypeCatalogChanged, orgID, nil, change)
+}
+
+// PublishProduct announces a change to a product
+func PublishProduct(tx *gorm.DB, product *models.Product, action string) error {
+	return PublishCatalog(tx, product.OrganizationID, CatalogChanged{
+		Entity:    "product",
+		ID:        &product.ID,
+		ProductID: &product.ID,
+		Action:    action,
+		Status:    product.Status,
+	})
+}
+
+// PublishVariant announces a change to a variant, including its current price
+func PublishVariant(tx *gorm.DB, orgID uuid.UUID, variant *models.Variant, action string) error {
+	change := CatalogChanged{
+		Entity:    "variant",
+		ID:        &variant.ID,
+		ProductID: &variant.ProductID,
+		Action:    action,
+		Status:    variant.Status,
+	}
+	if action != ActionDeleted {
+		change.SalePrice = &variant.SalePrice
+	}
+	return PublishCatalog(tx, orgID, change)
+}
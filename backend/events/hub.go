@@ -0,0 +1,94 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionBuffer is how many events a terminal may fall behind by before it is disconnected
+const subscriptionBuffer = 64
+
+// Subscription receives the events of one organization, optionally narrowed to a location.
+// C is closed when the subscriber falls too far behind or delivery was interrupted; the
+// terminal should then reconnect and catch up with catalog sync.
+type Subscription struct {
+	C          <-chan Event
+	events     chan Event
+	orgID      uuid.UUID
+	locationID *uuid.UUID
+}
+
+// Hub fans events out to the subscriptions of this server instance
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[uuid.UUID]map[*Subscription]struct{}
+}
+
+// Default is the hub the listener delivers to
+var Default = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{subscriptions: make(map[uuid.UUID]map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving the organization's events. A nil locationID receives events for all locations.
+func (h *Hub) Subscribe(orgID uuid.UUID, locationID *uuid.UUID) *Subscription {
+	events := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: events, events: events, orgID: orgID, locationID: locationID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscriptions[orgID] == nil {
+		h.subscriptions[orgID] = make(map[*Subscription]struct{})
+	}
+	h.subscriptions[orgID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops delivery to sub and closes its channel. It is safe to call more than once.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Dispatch delivers event to the matching subscriptions without blocking
+func (h *Hub) Dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscriptions[event.OrganizationID] {
+		if sub.locationID != nil && event.LocationID != nil && *sub.locationID != *event.LocationID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// DisconnectAll closes every subscription, after events may have been missed
+func (h *Hub) DisconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subscriptions {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// remove must be called with h.mu held
+func (h *Hub) remove(sub *Subscription) {
+	subs := h.subscriptions[sub.orgID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscriptions, sub.orgID)
+	}
+	close(sub.events)
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const maxListenBackoff = 30 * time.Second
+
+// Listen receives events published by any server instance and dispatches them to Default until
+// ctx is done, reconnecting when the database connection drops.
+func Listen(ctx context.Context, dsn string) {
+	backoff := time.Second
+	connected := false
+	for {
+		err := listen(ctx, dsn, func() {
+			// Events published while we were away are lost; make terminals catch up with a sync
+			if connected {
+				Default.DisconnectAll()
+			}
+			connected = true
+			backoff = time.Second
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Event listener disconnected: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+func listen(ctx context.Context, dsn string, onConnect func()) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	onConnect()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Ignoring malformed event: %v", err)
+			continue
+		}
+		Default.Dispatch(event)
+	}
+}
@@ -3,10 +3,10 @@ package handlers
 import (
 	"bstock/services"
 	"fmt"
-	"net/http"
-	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"net/http"
+	"time"
 )
 
 // GetAnalyticsSummary returns key business metrics
@@ -3,10 +3,9 @@ package handlers
 import (
 	"bstock/database"
 	"bstock/models"
+	"bstock/services"
 	"bstock/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"gorm.io/gorm"
 	"net/http"
 )
 
@@ -91,6 +90,18 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// Every organization starts with a single default location
+	location := models.Location{
+		OrganizationID: org.ID,
+		Name:           services.DefaultLocationName,
+		IsDefault:      true,
+	}
+	if err := tx.Create(&location).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create default location"})
+		return
+	}
+
 	// Get free plan and create subscription
 	var freePlan models.Plan
 	if err := tx.Where("name = ?", "free").First(&freePlan).Error; err != nil {
@@ -125,7 +136,7 @@ func Register(c *gin.Context) {
 	}
 
 	// Generate JWT
-	token, err := utils.GenerateJWT(user.ID, org.ID, "owner")
+	token, err := utils.GenerateJWT(user.ID, org.ID, "owner", nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -174,7 +185,7 @@ func Login(c *gin.Context) {
 	}
 
 	// Generate JWT
-	token, err := utils.GenerateJWT(user.ID, org.ID, orgUser.Role)
+	token, err := utils.GenerateJWT(user.ID, org.ID, orgUser.Role, orgUser.LocationID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bstock/events"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// eventHeartbeat keeps idle streams from being closed by proxies
+const eventHeartbeat = 25 * time.Second
+
+// StreamEvents pushes stock and catalog changes to a terminal as Server-Sent Events. Stock events
+// cover the caller's assigned location, or ?location_id= when given, or every location.
+// The stream ends with a "resync" event if the terminal may have missed events, or "token_expired"
+// when the JWT runs out; the terminal should then catch up with catalog sync and reconnect.
+func StreamEvents(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	locationID, ok := resolveRequestLocation(c, c.Query("location_id"))
+	if !ok {
+		return
+	}
+
+	sub := events.Default.Subscribe(orgID, locationID)
+	defer events.Default.Unsubscribe(sub)
+
+	var expired <-chan time.Time
+	if expiresAt, ok := c.Get("token_expires_at"); ok {
+		timer := time.NewTimer(time.Until(expiresAt.(time.Time)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+	c.Status(http.StatusOK)
+	c.SSEvent("ready", gin.H{"organization_id": orgID, "location_id": locationID})
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-expired:
+			c.SSEvent("token_expired", gin.H{})
+			c.Writer.Flush()
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				c.SSEvent("resync", gin.H{})
+				c.Writer.Flush()
+				return
+			}
+			c.SSEvent(event.Type, event)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
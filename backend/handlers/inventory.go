@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"bstock/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetInventoryValuation returns the value at cost of stock on hand
+func GetInventoryValuation(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var locationID *uuid.UUID
+	if l := c.Query("location_id"); l != "" {
+		var ok bool
+		if locationID, ok = resolveRequestLocation(c, l); !ok {
+			return
+		}
+	}
+
+	valuation, err := services.NewInventoryService().GetValuation(orgID, locationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute inventory valuation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, valuation)
+}
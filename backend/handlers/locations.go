@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreateLocationRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Address string `json:"address"`
+}
+
+type UpdateLocationRequest struct {
+	Name      *string `json:"name"`
+	Address   *string `json:"address"`
+	IsDefault *bool   `json:"is_default"`
+}
+
+// ListLocations returns all locations of the organization
+func ListLocations(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var locations []models.Location
+	if err := database.DB.Where("organization_id = ?", orgID).
+		Order("is_default DESC, name ASC").
+		Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
+
+// CreateLocation adds a new location, subject to the plan's location limit
+func CreateLocation(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var req CreateLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	location := models.Location{
+		OrganizationID: orgID,
+		Name:           req.Name,
+		Address:        req.Address,
+	}
+
+	if err := database.DB.Create(&location).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// UpdateLocation updates a location's details or makes it the default
+func UpdateLocation(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var req UpdateLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	location, err := services.NewLocationService().GetLocation(tx, orgID, locationID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if req.Name != nil {
+		location.Name = *req.Name
+	}
+	if req.Address != nil {
+		location.Address = *req.Address
+	}
+	if req.IsDefault != nil && *req.IsDefault && !location.IsDefault {
+		if err := tx.Model(&models.Location{}).
+			Where("organization_id = ? AND is_default = ?", orgID, true).
+			Update("is_default", false).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+			return
+		}
+		location.IsDefault = true
+	}
+
+	if err := tx.Save(location).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+// DeleteLocation removes a location that holds no stock and has no sales history
+func DeleteLocation(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	location, err := services.NewLocationService().GetLocation(database.DB, orgID, locationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if location.IsDefault {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the default location"})
+		return
+	}
+
+	var stockCount, saleCount int64
+	database.DB.Model(&models.StockLevel{}).Where("location_id = ? AND quantity <> 0", locationID).Count(&stockCount)
+	database.DB.Model(&models.Sale{}).Where("location_id = ?", locationID).Count(&saleCount)
+	if stockCount > 0 || saleCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Location still holds stock or has sales history"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Model(&models.OrganizationUser{}).
+		Where("organization_id = ? AND location_id = ?", orgID, locationID).
+		Update("location_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	var levelIDs []uuid.UUID
+	if err := tx.Model(&models.StockLevel{}).Where("location_id = ?", locationID).Pluck("id", &levelIDs).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	if err := tx.Where("location_id = ?", locationID).Delete(&models.StockLevel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	if err := services.NewSyncService().RecordDeleted(tx, orgID, models.TombstoneStockLevel, levelIDs...); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	if err := tx.Delete(location).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
+}
+
+// GetLocationStock returns the balance of every variant held at a location
+func GetLocationStock(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	location, err := services.NewLocationService().GetLocation(database.DB, orgID, locationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	type LocationStock struct {
+		VariantID     uuid.UUID `json:"variant_id"`
+		ProductID     uuid.UUID `json:"product_id"`
+		ProductName   string    `json:"product_name"`
+		SKU           string    `json:"sku"`
+		Quantity      float64   `json:"quantity"`
+		TotalQuantity float64   `json:"total_quantity"`
+	}
+
+	var stock []LocationStock
+	if err := database.DB.Table("stock_levels").
+		Select("variants.id as variant_id, products.id as product_id, products.name as product_name, variants.sku, stock_levels.quantity, variants.quantity as total_quantity").
+		Joins("JOIN variants ON variants.id = stock_levels.variant_id").
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("stock_levels.location_id = ? AND products.organization_id = ?", locationID, orgID).
+		Order("products.name ASC, variants.sku ASC").
+		Scan(&stock).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch location stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"location": location,
+		"stock":    stock,
+	})
+}
+
+// resolveRequestLocation picks the location a stock operation applies to.
+// Users assigned to a location always work there; others may name a location or fall back to the default.
+// It writes the error response and returns false when the location is not usable.
+func resolveRequestLocation(c *gin.Context, requested string) (*uuid.UUID, bool) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var locationID *uuid.UUID
+	if requested != "" {
+		parsed, err := uuid.Parse(requested)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return nil, false
+		}
+		locationID = &parsed
+	}
+
+	if assigned, exists := c.Get("location_id"); exists {
+		assignedID := assigned.(uuid.UUID)
+		if locationID != nil && *locationID != assignedID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only operate on your assigned location"})
+			return nil, false
+		}
+		locationID = &assignedID
+	}
+
+	if locationID == nil {
+		return nil, true
+	}
+
+	if _, err := services.NewLocationService().GetLocation(database.DB, orgID, *locationID); err != nil {
+		if errors.Is(err, services.ErrLocationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify location"})
+		}
+		return nil, false
+	}
+
+	return locationID, true
+}
+
+// ensureLocationAccess rejects users assigned to another location
+func ensureLocationAccess(c *gin.Context, locationID uuid.UUID) bool {
+	if assigned, exists := c.Get("location_id"); exists && assigned.(uuid.UUID) != locationID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only operate on your assigned location"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UpdateOrganizationSettingsRequest struct {
+	OversellPolicy *string `json:"oversell_policy" binding:"omitempty,oneof=reject allow_negative flag_conflict"`
+	CostingMethod  *string `json:"costing_method" binding:"omitempty,oneof=weighted_average fifo"`
+}
+
+type UpdateScaleBarcodeFormatsRequest struct {
+	Formats []ScaleBarcodeFormatRequest `json:"formats" binding:"dive"`
+}
+
+type ScaleBarcodeFormatRequest struct {
+	Prefix        string `json:"prefix" binding:"required,len=2,numeric,startswith=2"` // 20 to 29
+	PLULength     int    `json:"plu_length" binding:"required,min=1,max=9"`
+	ValueType     string `json:"value_type" binding:"required,oneof=weight price"`
+	ValueDecimals *int   `json:"value_decimals" binding:"omitempty,min=0,max=4"` // Defaults to 3 for weight, 2 for price
+}
+
+// GetOrganizationSettings returns the organization's operational settings
+func GetOrganizationSettings(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var org models.Organization
+	if err := database.DB.First(&org, orgID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, organizationSettings(&org))
+}
+
+// UpdateOrganizationSettings updates the organization's operational settings
+func UpdateOrganizationSettings(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var req UpdateOrganizationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var org models.Organization
+	if err := database.DB.First(&org, orgID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.OversellPolicy != nil {
+		updates["oversell_policy"] = *req.OversellPolicy
+	}
+	if req.CostingMethod != nil {
+		updates["costing_method"] = *req.CostingMethod
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&org).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, organizationSettings(&org))
+}
+
+func organizationSettings(org *models.Organization) gin.H {
+	return gin.H{
+		"oversell_policy": org.OversellPolicy,
+		"costing_method":  org.CostingMethod,
+	}
+}
+
+// ListScaleBarcodeFormats returns how the organization's scale barcodes are decoded, by prefix
+func ListScaleBarcodeFormats(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var formats []models.ScaleBarcodeFormat
+	if err := database.DB.Where("organization_id = ?", orgID).Order("prefix ASC").Find(&formats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scale barcode formats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, formats)
+}
+
+// UpdateScaleBarcodeFormats replaces the organization's scale barcode formats.
+// An empty list turns scale barcode decoding off.
+func UpdateScaleBarcodeFormats(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var req UpdateScaleBarcodeFormatsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	formats := make([]models.ScaleBarcodeFormat, 0, len(req.Formats))
+	seen := make(map[string]bool, len(req.Formats))
+	for _, formatReq := range req.Formats {
+		if seen[formatReq.Prefix] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate scale barcode prefix: " + formatReq.Prefix})
+			return
+		}
+		seen[formatReq.Prefix] = true
+
+		decimals := 2
+		if formatReq.ValueType == models.ScaleValueWeight {
+			decimals = 3
+		}
+		if formatReq.ValueDecimals != nil {
+			decimals = *formatReq.ValueDecimals
+		}
+
+		formats = append(formats, models.ScaleBarcodeFormat{
+			OrganizationID: orgID,
+			Prefix:         formatReq.Prefix,
+			PLULength:      formatReq.PLULength,
+			ValueType:      formatReq.ValueType,
+			ValueDecimals:  decimals,
+		})
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("organization_id = ?", orgID).Delete(&models.ScaleBarcodeFormat{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scale barcode formats"})
+		return
+	}
+	if len(formats) > 0 {
+		if err := tx.Create(&formats).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scale barcode formats"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scale barcode formats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, formats)
+}
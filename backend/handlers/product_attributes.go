@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/events"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AttributeDefinitionRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	Options []string `json:"options" binding:"required,min=1"`
+	Default string   `json:"default"` // Given to existing variants that lack this attribute
+}
+
+type SetAttributesRequest struct {
+	Attributes []AttributeDefinitionRequest `json:"attributes" binding:"omitempty,dive"`
+}
+
+type GenerateMatrixRequest struct {
+	SKUTemplate   string   `json:"sku_template"` // e.g. "{product}-{Size}-{Color}"
+	SalePrice     *float64 `json:"sale_price" binding:"omitempty,gt=0"`
+	PurchasePrice *float64 `json:"purchase_price" binding:"omitempty,gte=0"`
+	MinStockLevel *float64 `json:"min_stock_level" binding:"omitempty,gte=0"`
+	UnitType      string   `json:"unit_type"`
+	DryRun        bool     `json:"dry_run"`
+}
+
+// GetProductAttributes returns a product's attribute definitions
+func GetProductAttributes(c *gin.Context) {
+	product, ok := findProduct(c)
+	if !ok {
+		return
+	}
+
+	attributes, err := services.NewAttributeService().Definitions(database.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attributes)
+}
+
+// SetProductAttributes replaces a product's attribute definitions and refits its variants that are not archived
+func SetProductAttributes(c *gin.Context) {
+	product, ok := findProduct(c)
+	if !ok {
+		return
+	}
+
+	var req SetAttributesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	definitions := make([]services.AttributeDefinition, 0, len(req.Attributes))
+	for _, attrReq := range req.Attributes {
+		definitions = append(definitions, services.AttributeDefinition{
+			Name:    attrReq.Name,
+			Options: attrReq.Options,
+			Default: attrReq.Default,
+		})
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	attributes, conflicts, err := services.NewAttributeService().SetDefinitions(tx, product.ID, definitions)
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, services.ErrAttributeConflicts):
+			c.JSON(http.StatusConflict, gin.H{"error": "Existing variants do not fit these attributes", "conflicts": conflicts})
+		case errors.Is(err, services.ErrInvalidAttributeDefinition), errors.Is(err, services.ErrMatrixTooLarge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attributes"})
+		}
+		return
+	}
+	if err := events.PublishProduct(tx, product, events.ActionUpdated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attributes"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attributes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attributes)
+}
+
+// GenerateVariantMatrix creates the variants missing from the product's attribute matrix.
+// With dry_run the variants that would be created are returned without saving them.
+func GenerateVariantMatrix(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	product, ok := findProduct(c)
+	if !ok {
+		return
+	}
+
+	var req GenerateMatrixRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := services.NewAttributeService().GenerateMatrix(tx, services.MatrixInput{
+		OrganizationID: orgID,
+		ProductID:      product.ID,
+		SKUTemplate:    req.SKUTemplate,
+		SalePrice:      req.SalePrice,
+		PurchasePrice:  req.PurchasePrice,
+		MinStockLevel:  req.MinStockLevel,
+		UnitType:       req.UnitType,
+	})
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, services.ErrNoAttributes), errors.Is(err, services.ErrMatrixPriceRequired),
+			errors.Is(err, services.ErrInvalidSKUTemplate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrDuplicateSKU):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			if respondAttributeError(c, err) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate variants"})
+		}
+		return
+	}
+
+	if req.DryRun {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "result": result})
+		return
+	}
+
+	if err := events.PublishProduct(tx, product, events.ActionUpdated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate variants"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate variants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": false, "result": result})
+}
+
+// findProduct loads the organization's product named in the URL, responding 400/404 when it can't
+func findProduct(c *gin.Context) (*models.Product, bool) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return nil, false
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
+		First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+
+	return &product, true
+}
+
+// respondAttributeError writes the response for attribute validation errors and reports whether it did
+func respondAttributeError(c *gin.Context, err error) bool {
+	var attrErr *services.AttributeError
+	switch {
+	case errors.As(err, &attrErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Variant attributes do not match the product's definitions",
+			"attribute": attrErr.Attribute,
+			"detail":    attrErr.Message,
+		})
+		return true
+	case errors.Is(err, services.ErrDuplicateAttributes):
+		c.JSON(http.StatusConflict, gin.H{"error": "Another variant already has these attribute values"})
+		return true
+	}
+	return false
+}
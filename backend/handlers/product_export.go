@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bstock/services"
+	"bstock/utils"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExportProducts streams the catalog with stock, cost, sale price and stock value as CSV (default) or XLSX.
+// The columns match the import so an export can be edited and imported into another organization.
+func ExportProducts(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var locationID *uuid.UUID
+	if l := c.Query("location_id"); l != "" {
+		var ok bool
+		if locationID, ok = resolveRequestLocation(c, l); !ok {
+			return
+		}
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or xlsx"})
+		return
+	}
+
+	filename := fmt.Sprintf("catalog-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	exportService := services.NewExportService()
+	var err error
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+		var sheet *utils.XLSXWriter
+		if sheet, err = utils.NewXLSXWriter(c.Writer); err == nil {
+			if err = exportService.ExportCatalog(orgID, locationID, sheet.WriteRow); err == nil {
+				err = sheet.Close()
+			}
+		}
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+
+		writer := csv.NewWriter(c.Writer)
+		err = exportService.ExportCatalog(orgID, locationID, func(row []interface{}) error {
+			return writer.Write(csvRecord(row))
+		})
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+	}
+
+	if err != nil {
+		// Once streaming has started the status is already sent, so the download is just cut short
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+			return
+		}
+		c.Error(err)
+	}
+}
+
+// csvRecord formats export cells for encoding/csv. Text that a spreadsheet app would run as a
+// formula is quoted; the import strips the quote again.
+func csvRecord(row []interface{}) []string {
+	record := make([]string, len(row))
+	for i, cell := range row {
+		switch v := cell.(type) {
+		case nil:
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = utils.EscapeSpreadsheetText(fmt.Sprint(v))
+		}
+	}
+	return record
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListProductImages returns a product's images with signed URLs
+func ListProductImages(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var images []models.ProductImage
+	if err := database.DB.Where("product_id = ? AND organization_id = ?", productID, orgID).
+		Order("position ASC").
+		Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch images"})
+		return
+	}
+
+	signImages(images)
+	c.JSON(http.StatusOK, images)
+}
+
+// UploadProductImage stores a photo for a product, or for one of its variants when variant_id is given
+func UploadProductImage(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
+		First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var variantID *uuid.UUID
+	if v := c.PostForm("variant_id"); v != "" {
+		parsed, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+
+		var count int64
+		database.DB.Model(&models.Variant{}).Where("id = ? AND product_id = ?", parsed, productID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+		variantID = &parsed
+	}
+
+	storeProductImage(c, orgID, productID, variantID)
+}
+
+// UploadVariantImage stores a photo for a single variant
+func UploadVariantImage(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var variant models.Variant
+	if err := database.DB.Joins("JOIN products ON products.id = variants.product_id").
+		Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
+		First(&variant).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	storeProductImage(c, orgID, variant.ProductID, &variant.ID)
+}
+
+// DeleteProductImage removes an image and its stored files
+func DeleteProductImage(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	imageID, err := uuid.Parse(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	imageService := services.NewImageService()
+	image, err := imageService.Delete(tx, orgID, productID, imageID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, services.ErrImageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+
+	// Files go only once the row is gone for good
+	imageService.DeleteFiles([]models.ProductImage{*image})
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+}
+
+// storeProductImage reads the "image" form file and uploads it through the image service
+func storeProductImage(c *gin.Context, orgID, productID uuid.UUID, variantID *uuid.UUID) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No image file provided"})
+		return
+	}
+	if file.Size > services.MaxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large", "max_size": services.MaxImageSize})
+		return
+	}
+
+	opened, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+	defer opened.Close()
+
+	data, err := io.ReadAll(io.LimitReader(opened, services.MaxImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	image, err := services.NewImageService().Upload(database.DB, services.ImageUpload{
+		OrganizationID: orgID,
+		ProductID:      productID,
+		VariantID:      variantID,
+		Data:           data,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImageTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large", "max_size": services.MaxImageSize})
+		case errors.Is(err, services.ErrUnsupportedImage):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Image must be a JPEG, PNG or GIF"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		}
+		return
+	}
+
+	signImage(image)
+	c.JSON(http.StatusCreated, image)
+}
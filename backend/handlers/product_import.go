@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/events"
+	"bstock/services"
+	"bstock/utils"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxImportSize caps uploaded import files
+const maxImportSize = 10 << 20
+
+// ImportProducts creates products and variants from a CSV or XLSX upload.
+// Without confirm=true the file is only validated and a report of what would change is returned.
+func ImportProducts(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No import file provided"})
+		return
+	}
+	if file.Size > maxImportSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large"})
+		return
+	}
+
+	opened, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import file"})
+		return
+	}
+	defer opened.Close()
+
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".csv":
+		reader := csv.NewReader(opened)
+		reader.FieldsPerRecord = -1
+		records, err = reader.ReadAll()
+	case ".xlsx":
+		records, err = utils.ReadXLSX(opened, file.Size)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file must be .csv or .xlsx"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse import file: " + err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, c.PostForm("location_id"))
+	if !ok {
+		return
+	}
+
+	remaining, err := services.NewSubscriptionService().RemainingProducts(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve plan"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	report, err := services.NewImportService().ImportCatalog(tx, services.ImportInput{
+		OrganizationID: orgID,
+		UserID:         userID,
+		LocationID:     locationID,
+		Records:        records,
+		DryRun:         c.PostForm("confirm") != "true",
+		ProductLimit:   remaining,
+	})
+	if err != nil || report.DryRun {
+		tx.Rollback()
+	}
+
+	switch {
+	case errors.Is(err, services.ErrImportEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file has no data rows"})
+	case errors.Is(err, services.ErrImportOverLimit):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Import exceeds the product limit for your current plan",
+			"upgrade_required": true,
+			"report":           report,
+		})
+	case errors.Is(err, services.ErrImportInvalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Import file has invalid rows", "report": report})
+	case err != nil:
+		if respondQuantityError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products: " + err.Error()})
+	case report.DryRun:
+		c.JSON(http.StatusOK, report)
+	default:
+		if err := events.PublishCatalog(tx, orgID, events.CatalogChanged{Entity: "catalog", Action: events.ActionUpdated}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete import"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete import"})
+			return
+		}
+		c.JSON(http.StatusCreated, report)
+	}
+}
@@ -2,10 +2,18 @@ package handlers
 
 import (
 	"bstock/database"
+	"bstock/events"
 	"bstock/models"
+	"bstock/services"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type CreateProductRequest struct {
@@ -14,22 +22,35 @@ type CreateProductRequest struct {
 	Category    string                 `json:"category"`
 	ImageURL    string                 `json:"image_url"`
 	VendorID    *string                `json:"vendor_id"`
+	LocationID  string                 `json:"location_id"`                                   // Where opening stock is held
+	Status      string                 `json:"status" binding:"omitempty,oneof=active draft"` // Defaults to active; drafts don't count towards the plan limit
 	Variants    []CreateVariantRequest `json:"variants" binding:"required,min=1"`
 }
 
 type CreateVariantRequest struct {
 	Attributes    map[string]string `json:"attributes"`
 	SKU           string            `json:"sku" binding:"required"`
+	PLU           string            `json:"plu"` // Price look-up code printed in scale barcodes
 	PurchasePrice float64           `json:"purchase_price"`
 	SalePrice     float64           `json:"sale_price" binding:"required,gt=0"`
-	Quantity      int               `json:"quantity" binding:"gte=0"`
-	MinStockLevel int               `json:"min_stock_level"`
+	Quantity      float64           `json:"quantity" binding:"gte=0"`
+	MinStockLevel float64           `json:"min_stock_level"`
 	UnitType      string            `json:"unit_type"`
+	Barcodes      []string          `json:"barcodes"` // EAN-13, UPC-A or Code128
+	Packs         []PackUnitRequest `json:"packs" binding:"omitempty,dive"`
+	Status        string            `json:"status" binding:"omitempty,oneof=active draft"` // Defaults to active
+}
+
+type PackUnitRequest struct {
+	Name      string   `json:"name" binding:"required"`             // e.g. "carton"
+	Factor    float64  `json:"factor" binding:"required,gt=0"`      // Base units per pack, e.g. 24
+	SalePrice *float64 `json:"sale_price" binding:"omitempty,gt=0"` // Price when sold by the pack
 }
 
 // CreateProduct creates a new product with variants
 func CreateProduct(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
 
 	var req CreateProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -37,6 +58,19 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
+	status := req.Status
+	if status == "" {
+		status = models.CatalogStatusActive
+	}
+	if status == models.CatalogStatusActive && !ensureProductCapacity(c, orgID) {
+		return
+	}
+
 	tx := database.DB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -51,6 +85,7 @@ func CreateProduct(c *gin.Context) {
 		Description:    req.Description,
 		Category:       req.Category,
 		ImageURL:       req.ImageURL,
+		Status:         status,
 	}
 
 	if req.VendorID != nil {
@@ -69,87 +104,161 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
-	// Create variants
-	for _, varReq := range req.Variants {
-		variant := models.Variant{
-			ProductID:     product.ID,
-			Attributes:    varReq.Attributes,
-			SKU:           varReq.SKU,
-			PurchasePrice: varReq.PurchasePrice,
-			SalePrice:     varReq.SalePrice,
-			Quantity:      varReq.Quantity,
-			MinStockLevel: varReq.MinStockLevel,
-			UnitType:      varReq.UnitType,
-		}
-
-		if variant.UnitType == "" {
-			variant.UnitType = "pcs"
-		}
-
-		if err := tx.Create(&variant).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create variant: " + err.Error()})
+	// Create variants, posting opening stock to the ledger
+	for position, varReq := range req.Variants {
+		if _, ok := createVariant(c, tx, orgID, userID, product.ID, locationID, varReq, position); !ok {
 			return
 		}
 	}
 
+	if err := events.PublishProduct(tx, &product, events.ActionCreated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete product creation"})
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete product creation"})
 		return
 	}
 
 	// Reload with variants
-	database.DB.Preload("Variants").Preload("Vendor").First(&product, product.ID)
+	database.DB.Preload("Variants", currentVariants).Preload("Variants.Barcodes").Preload("Variants.Packs").Preload("Vendor").Preload("Images", orderImages).First(&product, product.ID)
+	signImages(product.Images)
 	c.JSON(http.StatusCreated, product)
 }
 
-// ListProducts returns all products for the organization
+// ListProducts returns a page of the organization's products, active ones unless another status (or "all") is asked for.
+// Query parameters: sort (name, updated_at, stock), order (asc, desc), limit, cursor (next_cursor from the previous page),
+// category, search, vendor_id, attr[<name>]=<value>, min_price, max_price and low_stock=true.
 func ListProducts(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
+	status := c.DefaultQuery("status", models.CatalogStatusActive)
 
-	// Optional filters
-	category := c.Query("category")
-	search := c.Query("search")
-	lowStock := c.Query("low_stock") // "true" to filter low stock items
+	q := services.ProductListQuery{
+		OrganizationID: orgID,
+		Category:       c.Query("category"),
+		Search:         c.Query("search"),
+		Attributes:     c.QueryMap("attr"),
+		LowStock:       c.Query("low_stock") == "true",
+		Sort:           c.DefaultQuery("sort", "name"),
+		Cursor:         c.Query("cursor"),
+	}
 
-	query := database.DB.Where("organization_id = ?", orgID)
+	// The POS only sees active variants of active products; other listings show everything not archived
+	variantScope := currentVariants
+	switch status {
+	case models.CatalogStatusActive:
+		variantScope = activeVariants
+		q.Statuses = []string{status}
+		q.VariantStatus = models.CatalogStatusActive
+	case models.CatalogStatusDraft, models.CatalogStatusArchived:
+		q.Statuses = []string{status}
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be active, draft, archived or all"})
+		return
+	}
 
-	if category != "" {
-		query = query.Where("category = ?", category)
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order must be asc or desc"})
+		return
+	}
+	if q.Sort != "name" && q.Sort != "updated_at" && q.Sort != "stock" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sort must be name, updated_at or stock"})
+		return
 	}
 
-	if search != "" {
-		query = query.Where("name ILIKE ?", "%"+search+"%")
+	if l := c.Query("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be a positive number"})
+			return
+		}
+		q.Limit = limit
+	}
+	if v := c.Query("vendor_id"); v != "" {
+		vendorID, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+			return
+		}
+		q.VendorID = &vendorID
+	}
+	var ok bool
+	if q.MinPrice, ok = priceQuery(c, "min_price"); !ok {
+		return
+	}
+	if q.MaxPrice, ok = priceQuery(c, "max_price"); !ok {
+		return
 	}
 
-	var products []models.Product
-	if err := query.Preload("Variants").Preload("Vendor").Find(&products).Error; err != nil {
+	page, err := services.NewProductService().List(database.DB, q, func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Variants", variantScope).Preload("Variants.Barcodes").Preload("Variants.Packs").Preload("Vendor").Preload("Images", orderImages)
+	})
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor; start again without one"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
+	signProductImages(page.Products)
 
-	// Filter low stock if requested
-	if lowStock == "true" {
-		filtered := []models.Product{}
-		for _, product := range products {
-			hasLowStock := false
-			for _, variant := range product.Variants {
-				if variant.Quantity <= variant.MinStockLevel {
-					hasLowStock = true
-					break
-				}
-			}
-			if hasLowStock {
-				filtered = append(filtered, product)
-			}
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchProducts ranks sellable variants matching q across names, SKUs, barcodes, attributes,
+// categories and descriptions, for the POS search box
+func SearchProducts(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+	limit := services.DefaultSearchLimit
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be a positive number"})
+			return
 		}
-		products = filtered
 	}
 
-	c.JSON(http.StatusOK, products)
+	hits, err := services.NewSearchService().Search(database.DB, orgID, q, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products"})
+		return
+	}
+	for i := range hits {
+		signImages(hits[i].Variant.Product.Images)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": q, "results": hits})
+}
+
+// priceQuery parses an optional price query parameter, responding 400 when it is invalid
+func priceQuery(c *gin.Context, param string) (*float64, bool) {
+	v := c.Query(param)
+	if v == "" {
+		return nil, true
+	}
+	price, err := strconv.ParseFloat(v, 64)
+	if err != nil || price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+		return nil, false
+	}
+	return &price, true
 }
 
-// GetProduct returns a single product with all variants
+// GetProduct returns a single product with its variants, including archived ones when include_archived=true
 func GetProduct(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	productID, err := uuid.Parse(c.Param("id"))
@@ -158,15 +267,27 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
+	variantScope := currentVariants
+	if c.Query("include_archived") == "true" {
+		variantScope = orderVariants
+	}
+
 	var product models.Product
 	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
-		Preload("Variants").
+		Preload("Variants", variantScope).
+		Preload("Variants.StockLevels").
+		Preload("Variants.Barcodes").
+		Preload("Variants.Packs").
 		Preload("Vendor").
+		Preload("Images", orderImages).
+		Preload("Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
 		First(&product).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	signImages(product.Images)
+	c.Header("ETag", etag(product.Version))
 	c.JSON(http.StatusOK, product)
 }
 
@@ -176,9 +297,11 @@ type UpdateProductRequest struct {
 	Category    *string `json:"category"`
 	ImageURL    *string `json:"image_url"`
 	VendorID    *string `json:"vendor_id"`
+	Status      *string `json:"status" binding:"omitempty,oneof=active draft"` // Archiving has its own endpoints
 }
 
-// UpdateProduct updates product details (not variants)
+// UpdateProduct updates product details (not variants). The ETag from GetProduct must be sent as
+// If-Match; the update is refused with 409 if someone else changed the product in the meantime.
 func UpdateProduct(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	productID, err := uuid.Parse(c.Param("id"))
@@ -186,19 +309,46 @@ func UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
 		return
 	}
+	if !requireIfMatch(c) {
+		return
+	}
+
+	var req UpdateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var vendorID *uuid.UUID
+	if req.VendorID != nil {
+		parsed, err := uuid.Parse(*req.VendorID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+			return
+		}
+		vendorID = &parsed
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
 	var product models.Product
-	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
+	if err := tx.Where("id = ? AND organization_id = ?", productID, orgID).
 		First(&product).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
-	var req UpdateProductRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !ifMatch(c, product.Version) {
+		tx.Rollback()
+		respondProductConflict(c, product.ID)
 		return
 	}
+	version := product.Version
 
 	// Update fields if provided
 	if req.Name != nil {
@@ -213,45 +363,243 @@ func UpdateProduct(c *gin.Context) {
 	if req.ImageURL != nil {
 		product.ImageURL = *req.ImageURL
 	}
-	if req.VendorID != nil {
-		vendorID, err := uuid.Parse(*req.VendorID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+	if vendorID != nil {
+		product.VendorID = vendorID
+	}
+	if req.Status != nil && *req.Status != product.Status {
+		if product.Status == models.CatalogStatusArchived {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "Archived products must be unarchived first"})
 			return
 		}
-		product.VendorID = &vendorID
+		if *req.Status == models.CatalogStatusActive && !ensureProductCapacity(c, orgID) {
+			tx.Rollback()
+			return
+		}
+		product.Status = *req.Status
 	}
 
-	if err := database.DB.Save(&product).Error; err != nil {
+	err = services.NewProductService().Update(tx, &product, version)
+	if errors.Is(err, services.ErrVersionConflict) {
+		tx.Rollback()
+		respondProductConflict(c, product.ID)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
 
-	database.DB.Preload("Variants").Preload("Vendor").First(&product, product.ID)
+	if err := events.PublishProduct(tx, &product, events.ActionUpdated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	database.DB.Preload("Variants", currentVariants).Preload("Vendor").First(&product, product.ID)
+	c.Header("ETag", etag(product.Version))
 	c.JSON(http.StatusOK, product)
 }
 
-// DeleteProduct deletes a product and all its variants
+// respondProductConflict responds 409 with the product as it now stands, so the client can merge and retry
+func respondProductConflict(c *gin.Context, productID uuid.UUID) {
+	var current models.Product
+	if err := database.DB.Preload("Variants", currentVariants).Preload("Vendor").First(&current, productID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "Product was changed by someone else; review the current version and retry",
+		"current": current,
+	})
+}
+
+// etag is the entity tag of a product or variant at version
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// requireIfMatch responds 428 unless the request carries an If-Match header, so edits can't
+// silently overwrite changes the client never saw
+func requireIfMatch(c *gin.Context) bool {
+	if c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Send the ETag you last read as If-Match"})
+		return false
+	}
+	return true
+}
+
+// ifMatch reports whether the request's If-Match header names version. Tags are compared
+// strongly, so weak W/ tags never match.
+func ifMatch(c *gin.Context, version int) bool {
+	current := etag(version)
+	for _, tag := range strings.Split(c.GetHeader("If-Match"), ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteProduct deletes a product and its variants. Products with stock or history are archived instead.
 func DeleteProduct(c *gin.Context) {
+	var images []models.ProductImage
+	deleted := changeProductLifecycle(c, func(tx *gorm.DB, product *models.Product) (gin.H, error) {
+		if err := tx.Where("product_id = ?", product.ID).Find(&images).Error; err != nil {
+			return nil, err
+		}
+
+		archived, err := services.NewProductService().Remove(tx, product)
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			images = nil
+			if err := events.PublishProduct(tx, product, events.ActionUpdated); err != nil {
+				return nil, err
+			}
+			return gin.H{"message": "Product has history and was archived", "archived": true, "product": product}, nil
+		}
+		if err := events.PublishProduct(tx, product, events.ActionDeleted); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Product deleted successfully", "archived": false}, nil
+	})
+
+	// Files go only once the rows are gone for good
+	if deleted {
+		services.NewImageService().DeleteFiles(images)
+	}
+}
+
+// ArchiveProduct hides a product from the POS while keeping it for reports
+func ArchiveProduct(c *gin.Context) {
+	changeProductLifecycle(c, func(tx *gorm.DB, product *models.Product) (gin.H, error) {
+		if err := services.NewProductService().Archive(tx, product); err != nil {
+			return nil, err
+		}
+		if err := events.PublishProduct(tx, product, events.ActionUpdated); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Product archived", "product": product}, nil
+	})
+}
+
+// UnarchiveProduct makes an archived product active again, within the plan's product limit
+func UnarchiveProduct(c *gin.Context) {
+	changeProductLifecycle(c, func(tx *gorm.DB, product *models.Product) (gin.H, error) {
+		if err := services.NewProductService().Unarchive(tx, product); err != nil {
+			return nil, err
+		}
+		if err := events.PublishProduct(tx, product, events.ActionUpdated); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Product unarchived", "product": product}, nil
+	})
+}
+
+// changeProductLifecycle loads the product in the URL and applies change to it in a transaction.
+// It reports whether the change was committed.
+func changeProductLifecycle(c *gin.Context, change func(tx *gorm.DB, product *models.Product) (gin.H, error)) bool {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	productID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
-		return
+		return false
 	}
 
-	result := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
-		Delete(&models.Product{})
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
-		return
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND organization_id = ?", productID, orgID).
+		First(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return false
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	response, err := change(tx, &product)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return false
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return false
+	}
+
+	c.JSON(http.StatusOK, response)
+	return true
+}
+
+// ensureProductCapacity responds 403 when the plan allows no more active products
+func ensureProductCapacity(c *gin.Context, orgID uuid.UUID) bool {
+	allowed, err := services.NewSubscriptionService().CanAddProduct(orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve plan"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Product limit reached for your current plan",
+			"upgrade_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+func packUnits(reqs []PackUnitRequest) []models.PackUnit {
+	packs := make([]models.PackUnit, 0, len(reqs))
+	for _, packReq := range reqs {
+		packs = append(packs, models.PackUnit{
+			Name:      packReq.Name,
+			Factor:    packReq.Factor,
+			SalePrice: packReq.SalePrice,
+		})
+	}
+	return packs
+}
+
+func respondPackError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrDuplicatePack) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pack units"})
+}
+
+// orderVariants preloads variants in display order
+func orderVariants(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC, created_at ASC")
+}
+
+// activeVariants preloads the variants sold at the POS, in display order
+func activeVariants(db *gorm.DB) *gorm.DB {
+	return orderVariants(db).Where("status = ?", models.CatalogStatusActive)
+}
+
+// currentVariants preloads active and draft variants, in display order
+func currentVariants(db *gorm.DB) *gorm.DB {
+	return orderVariants(db).Where("status <> ?", models.CatalogStatusArchived)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+// orderImages preloads product images in display order
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
 }
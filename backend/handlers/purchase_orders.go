@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreatePurchaseOrderRequest struct {
+	VendorID   string                     `json:"vendor_id" binding:"required"`
+	LocationID string                     `json:"location_id"` // Defaults to the default location
+	Reference  string                     `json:"reference"`
+	ExpectedAt *time.Time                 `json:"expected_at"`
+	Note       string                     `json:"note"`
+	Lines      []PurchaseOrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type PurchaseOrderLineRequest struct {
+	VariantID string  `json:"variant_id" binding:"required"`
+	Quantity  float64 `json:"quantity" binding:"required,gt=0"`
+	UnitCost  float64 `json:"unit_cost" binding:"gte=0"`
+	Pack      string  `json:"pack"` // Pack unit the quantity and cost are given in, stored in base units
+}
+
+type ReceiveGoodsRequest struct {
+	LocationID string                    `json:"location_id"` // Defaults to the order's delivery location
+	Note       string                    `json:"note"`
+	Items      []ReceiveGoodsItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type ReceiveGoodsItemRequest struct {
+	LineID   string   `json:"line_id" binding:"required"`
+	Quantity float64  `json:"quantity" binding:"required,gt=0"`
+	UnitCost *float64 `json:"unit_cost" binding:"omitempty,gte=0"` // Actual cost if it differs from the order
+	Pack     string   `json:"pack"`                                // Pack unit the quantity and cost are given in
+}
+
+// ListPurchaseOrders returns purchase orders, optionally filtered by status
+func ListPurchaseOrders(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	query := database.DB.Where("organization_id = ?", orgID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	listPurchaseOrders(c, query)
+}
+
+// ListVendorPurchaseOrders returns all purchase orders placed with a vendor
+func ListVendorPurchaseOrders(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	vendorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+		return
+	}
+
+	var vendor models.Vendor
+	if err := database.DB.Where("id = ? AND organization_id = ?", vendorID, orgID).
+		First(&vendor).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor not found"})
+		return
+	}
+
+	query := database.DB.Where("organization_id = ? AND vendor_id = ?", orgID, vendorID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	listPurchaseOrders(c, query)
+}
+
+func listPurchaseOrders(c *gin.Context, query *gorm.DB) {
+	var orders []models.PurchaseOrder
+	if err := query.
+		Preload("Vendor").
+		Preload("Location").
+		Preload("Lines").
+		Order("created_at DESC").
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetPurchaseOrder returns a purchase order with its lines and receipts
+func GetPurchaseOrder(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var order models.PurchaseOrder
+	if err := database.DB.Where("id = ? AND organization_id = ?", orderID, orgID).
+		Preload("Vendor").
+		Preload("Location").
+		Preload("Lines.Variant.Product").
+		Preload("Receipts.Items").
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// CreatePurchaseOrder drafts a purchase order with a vendor
+func CreatePurchaseOrder(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req CreatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vendorID, err := uuid.Parse(req.VendorID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+		return
+	}
+
+	var vendor models.Vendor
+	if err := database.DB.Where("id = ? AND organization_id = ?", vendorID, orgID).
+		First(&vendor).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor not found"})
+		return
+	}
+
+	requestedLocation, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+	locationID, err := services.NewLocationService().ResolveLocationID(database.DB, orgID, requestedLocation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve location"})
+		return
+	}
+
+	order := models.PurchaseOrder{
+		OrganizationID: orgID,
+		VendorID:       vendorID,
+		LocationID:     locationID,
+		Reference:      req.Reference,
+		Status:         models.PurchaseOrderStatusDraft,
+		ExpectedAt:     req.ExpectedAt,
+		Note:           req.Note,
+		CreatedBy:      userID,
+	}
+
+	for _, lineReq := range req.Lines {
+		variantID, err := uuid.Parse(lineReq.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + lineReq.VariantID})
+			return
+		}
+
+		var count int64
+		database.DB.Model(&models.Variant{}).
+			Joins("JOIN products ON products.id = variants.product_id").
+			Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found: " + lineReq.VariantID})
+			return
+		}
+
+		quantity, unitCost := lineReq.Quantity, lineReq.UnitCost
+		if lineReq.Pack != "" {
+			pack, err := services.NewInventoryService().FindPack(database.DB, variantID, lineReq.Pack)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown pack unit: " + lineReq.Pack})
+				return
+			}
+			quantity, unitCost = pack.BaseQuantity(quantity), pack.BaseUnitCost(unitCost)
+		}
+
+		order.TotalCost += unitCost * quantity
+		order.Lines = append(order.Lines, models.PurchaseOrderLine{
+			VariantID: variantID,
+			Quantity:  quantity,
+			UnitCost:  unitCost,
+		})
+	}
+
+	if err := database.DB.Create(&order).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order"})
+		return
+	}
+
+	database.DB.Preload("Vendor").Preload("Location").Preload("Lines").First(&order, order.ID)
+	c.JSON(http.StatusCreated, order)
+}
+
+// SubmitPurchaseOrder marks a draft order as placed with the vendor
+func SubmitPurchaseOrder(c *gin.Context) {
+	transitionPurchaseOrder(c, []string{models.PurchaseOrderStatusDraft}, models.PurchaseOrderStatusOrdered)
+}
+
+// CancelPurchaseOrder cancels an order before any goods have been received against it
+func CancelPurchaseOrder(c *gin.Context) {
+	transitionPurchaseOrder(c, []string{models.PurchaseOrderStatusDraft, models.PurchaseOrderStatusOrdered}, models.PurchaseOrderStatusCancelled)
+}
+
+func transitionPurchaseOrder(c *gin.Context, from []string, to string) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	result := database.DB.Model(&models.PurchaseOrder{}).
+		Where("id = ? AND organization_id = ? AND status IN ?", orderID, orgID, from).
+		Update("status", to)
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Purchase order not found or not in a valid status for this action"})
+		return
+	}
+
+	var order models.PurchaseOrder
+	database.DB.Preload("Vendor").Preload("Location").Preload("Lines").First(&order, orderID)
+	c.JSON(http.StatusOK, order)
+}
+
+// ReceivePurchaseOrder records a (possibly partial) delivery of goods against an order
+func ReceivePurchaseOrder(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var req ReceiveGoodsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
+	items := make([]services.ReceiptItemInput, 0, len(req.Items))
+	for _, itemReq := range req.Items {
+		lineID, err := uuid.Parse(itemReq.LineID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid line ID: " + itemReq.LineID})
+			return
+		}
+		items = append(items, services.ReceiptItemInput{
+			LineID:   lineID,
+			Quantity: itemReq.Quantity,
+			Pack:     itemReq.Pack,
+			UnitCost: itemReq.UnitCost,
+		})
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.PurchaseOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND organization_id = ?", orderID, orgID).
+		Preload("Lines").
+		First(&order).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	receipt, err := services.NewPurchasingService().ReceiveGoods(tx, &order, services.ReceiptInput{
+		UserID:     userID,
+		LocationID: locationID,
+		Note:       req.Note,
+		Items:      items,
+	})
+	if err != nil {
+		tx.Rollback()
+		if respondQuantityError(c, err) {
+			return
+		}
+
+		var overErr *services.OverReceiptError
+		switch {
+		case errors.As(err, &overErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "Received quantity exceeds quantity outstanding",
+				"line_id":     overErr.LineID.String(),
+				"outstanding": overErr.Outstanding,
+				"received":    overErr.Received,
+			})
+		case errors.Is(err, services.ErrPurchaseOrderStatus):
+			c.JSON(http.StatusConflict, gin.H{"error": "Goods can only be received on ordered purchase orders"})
+		case errors.Is(err, services.ErrLineNotOnOrder):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Line does not belong to this purchase order"})
+		case errors.Is(err, services.ErrPackNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive goods"})
+		}
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete goods receipt"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"receipt":        receipt,
+		"purchase_order": order,
+	})
+}
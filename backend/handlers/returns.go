@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+type CreateReturnRequest struct {
+	Items        []ReturnItemRequest `json:"items" binding:"omitempty,dive"` // Empty for a full return
+	Damaged      bool                `json:"damaged"`                        // Write off everything in a full return
+	RefundMethod string              `json:"refund_method"`
+	RefundAmount *float64            `json:"refund_amount" binding:"omitempty,gte=0"`
+	Reason       string              `json:"reason"`
+}
+
+type ReturnItemRequest struct {
+	SaleItemID string  `json:"sale_item_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"required,gt=0"`
+	Damaged    bool    `json:"damaged"`
+}
+
+// CreateSaleReturn processes a full or partial return against a sale
+func CreateSaleReturn(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]services.ReturnItemInput, 0, len(req.Items))
+	for _, itemReq := range req.Items {
+		saleItemID, err := uuid.Parse(itemReq.SaleItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale item ID: " + itemReq.SaleItemID})
+			return
+		}
+		items = append(items, services.ReturnItemInput{
+			SaleItemID: saleItemID,
+			Quantity:   itemReq.Quantity,
+			Damaged:    itemReq.Damaged,
+		})
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the sale so concurrent returns cannot both claim the same units
+	var sale models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND organization_id = ?", saleID, orgID).
+		Preload("Items").
+		First(&sale).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		return
+	}
+
+	salesService := services.NewSalesService()
+	saleReturn, err := salesService.CreateReturn(tx, services.ReturnInput{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Sale:           &sale,
+		Items:          items,
+		Damaged:        req.Damaged,
+		RefundMethod:   req.RefundMethod,
+		RefundAmount:   req.RefundAmount,
+		Reason:         req.Reason,
+	})
+	if err != nil {
+		tx.Rollback()
+		if respondQuantityError(c, err) {
+			return
+		}
+
+		var quantityErr *services.ReturnQuantityError
+		switch {
+		case errors.As(err, &quantityErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":        "Return quantity exceeds quantity sold",
+				"sale_item_id": quantityErr.SaleItemID.String(),
+				"returnable":   quantityErr.Returnable,
+				"requested":    quantityErr.Requested,
+			})
+		case errors.Is(err, services.ErrSaleItemNotInSale):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sale item does not belong to this sale"})
+		case errors.Is(err, services.ErrNothingToReturn):
+			c.JSON(http.StatusConflict, gin.H{"error": "Sale has already been fully returned"})
+		case errors.Is(err, services.ErrRefundExceedsReturn):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount exceeds value of returned goods"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process return"})
+		}
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete return"})
+		return
+	}
+
+	database.DB.Preload("Items.Variant.Product").Preload("User").First(saleReturn, saleReturn.ID)
+	c.JSON(http.StatusCreated, saleReturn)
+}
+
+// ListSaleReturns returns all returns recorded against a sale
+func ListSaleReturns(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var returns []models.SaleReturn
+	if err := database.DB.Where("sale_id = ? AND organization_id = ?", saleID, orgID).
+		Preload("Items.Variant.Product").
+		Preload("User").
+		Order("created_at DESC").
+		Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, returns)
+}
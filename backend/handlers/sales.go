@@ -3,7 +3,10 @@ package handlers
 import (
 	"bstock/database"
 	"bstock/models"
+	"bstock/services"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -13,12 +16,15 @@ import (
 
 type CreateSaleRequest struct {
 	PaymentMethod string            `json:"payment_method" binding:"required"`
+	LocationID    string            `json:"location_id"` // Defaults to the cashier's assigned location
 	Items         []SaleItemRequest `json:"items" binding:"required,min=1"`
 }
 
 type SaleItemRequest struct {
-	VariantID string `json:"variant_id" binding:"required"`
-	Quantity  int    `json:"quantity" binding:"required,gt=0"`
+	VariantID string  `json:"variant_id"`
+	Barcode   string  `json:"barcode"`  // Alternative to variant_id
+	Quantity  float64 `json:"quantity"` // Taken from the barcode for scale barcodes
+	Pack      string  `json:"pack"`     // Pack unit the quantity is counted in
 }
 
 // ProcessSale creates a new sale and decrements inventory atomically
@@ -32,6 +38,17 @@ func ProcessSale(c *gin.Context) {
 		return
 	}
 
+	items, err := parseSaleItems(orgID, req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
 	// Start atomic transaction
 	tx := database.DB.Begin()
 	defer func() {
@@ -40,102 +57,291 @@ func ProcessSale(c *gin.Context) {
 		}
 	}()
 
-	var totalAmount float64
-	var totalProfit float64
-	var saleItems []models.SaleItem
+	salesService := services.NewSalesService()
+	sale, err := salesService.CreateSale(tx, services.SaleInput{
+		OrganizationID: orgID,
+		UserID:         userID,
+		LocationID:     locationID,
+		PaymentMethod:  req.PaymentMethod,
+		Items:          items,
+	})
+	if err != nil {
+		tx.Rollback()
+		respondSaleError(c, err)
+		return
+	}
 
-	// Process each item
-	for _, itemReq := range req.Items {
-		variantID, err := uuid.Parse(itemReq.VariantID)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + itemReq.VariantID})
-			return
-		}
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sale"})
+		return
+	}
 
-		// Lock variant row for update
-		var variant models.Variant
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").
-			Joins("JOIN products ON products.id = variants.product_id").
-			Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
-			First(&variant).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found: " + itemReq.VariantID})
-			return
-		}
+	// Reload with associations
+	database.DB.Preload("Items.Variant.Product").Preload("User").Preload("Location").First(sale, sale.ID)
+	c.JSON(http.StatusCreated, sale)
+}
 
-		// Check stock availability
-		if variant.Quantity < itemReq.Quantity {
-			tx.Rollback()
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":     "Insufficient stock",
-				"variant_id": variantID.String(),
-				"available":  variant.Quantity,
-				"requested":  itemReq.Quantity,
-			})
-			return
-		}
+type SyncSalesRequest struct {
+	LocationID string            `json:"location_id"` // Location of the device, defaults to the cashier's assigned location
+	Sales      []SyncSaleRequest `json:"sales" binding:"required,min=1,max=200"`
+}
 
-		// Calculate amounts
-		itemTotal := variant.SalePrice * float64(itemReq.Quantity)
-		itemCost := variant.PurchasePrice * float64(itemReq.Quantity)
-		itemProfit := itemTotal - itemCost
+type SyncSaleRequest struct {
+	ClientSaleID  string            `json:"client_sale_id"`
+	SoldAt        time.Time         `json:"sold_at"` // Original device timestamp
+	PaymentMethod string            `json:"payment_method"`
+	Items         []SaleItemRequest `json:"items"`
+}
 
-		totalAmount += itemTotal
-		totalProfit += itemProfit
+// Per-sale outcomes reported by SyncSales
+const (
+	SyncStatusCreated        = "created"
+	SyncStatusAlreadyApplied = "already_applied"
+	SyncStatusRejected       = "rejected"
+)
 
-		// Decrement stock
-		variant.Quantity -= itemReq.Quantity
-		if err := tx.Save(&variant).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
-			return
-		}
+type SyncSaleResult struct {
+	ClientSaleID string     `json:"client_sale_id"`
+	Status       string     `json:"status"`
+	SaleID       *uuid.UUID `json:"sale_id,omitempty"`
+	Conflicts    int        `json:"conflicts,omitempty"` // Oversold lines flagged for the owner
+	Error        string     `json:"error,omitempty"`
+	Details      gin.H      `json:"details,omitempty"`
+}
 
-		// Prepare sale item
-		saleItems = append(saleItems, models.SaleItem{
-			VariantID:           variantID,
-			Quantity:            itemReq.Quantity,
-			PriceAtSale:         variant.SalePrice,
-			PurchasePriceAtSale: variant.PurchasePrice,
-		})
+// SyncSales applies a batch of offline sales exactly once, keyed by their device-generated IDs.
+// Each sale runs in its own transaction so one rejection does not block the rest of the queue.
+func SyncSales(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req SyncSalesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Create sale record
-	sale := models.Sale{
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
+	// Money for synced sales has already been taken, so oversells follow the org's policy
+	var org models.Organization
+	if err := database.DB.First(&org, orgID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization"})
+		return
+	}
+
+	salesService := services.NewSalesService()
+	results := make([]SyncSaleResult, 0, len(req.Sales))
+	counts := map[string]int{
+		SyncStatusCreated:        0,
+		SyncStatusAlreadyApplied: 0,
+		SyncStatusRejected:       0,
+	}
+
+	for _, saleReq := range req.Sales {
+		result := syncSale(salesService, orgID, userID, locationID, org.OversellPolicy, saleReq)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":         results,
+		"created":         counts[SyncStatusCreated],
+		"already_applied": counts[SyncStatusAlreadyApplied],
+		"rejected":        counts[SyncStatusRejected],
+	})
+}
+
+func syncSale(salesService *services.SalesService, orgID, userID uuid.UUID, locationID *uuid.UUID, oversellPolicy string, req SyncSaleRequest) SyncSaleResult {
+	result := SyncSaleResult{ClientSaleID: req.ClientSaleID}
+
+	clientSaleID, err := uuid.Parse(req.ClientSaleID)
+	if err != nil {
+		result.Status = SyncStatusRejected
+		result.Error = "Invalid client sale ID"
+		return result
+	}
+	if req.PaymentMethod == "" {
+		result.Status = SyncStatusRejected
+		result.Error = "Payment method is required"
+		return result
+	}
+	if len(req.Items) == 0 {
+		result.Status = SyncStatusRejected
+		result.Error = "Sale has no items"
+		return result
+	}
+
+	items, err := parseSaleItems(orgID, req.Items)
+	if err != nil {
+		result.Status = SyncStatusRejected
+		result.Error = err.Error()
+		return result
+	}
+
+	// A retried upload of a sale we already hold is acknowledged, not re-applied
+	if existing, err := salesService.FindByClientSaleID(database.DB, orgID, clientSaleID); err == nil {
+		result.Status = SyncStatusAlreadyApplied
+		result.SaleID = &existing.ID
+		return result
+	}
+
+	soldAt := req.SoldAt
+	if soldAt.IsZero() || soldAt.After(time.Now()) {
+		soldAt = time.Now()
+	}
+
+	tx := database.DB.Begin()
+	sale, err := salesService.CreateSale(tx, services.SaleInput{
 		OrganizationID: orgID,
 		UserID:         userID,
-		TotalAmount:    totalAmount,
-		TotalProfit:    totalProfit,
+		LocationID:     locationID,
 		PaymentMethod:  req.PaymentMethod,
-		IsSynced:       true,
+		Items:          items,
+		ClientSaleID:   &clientSaleID,
+		SoldAt:         &soldAt,
+		OversellPolicy: oversellPolicy,
+	})
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
 	}
 
-	if err := tx.Create(&sale).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale"})
-		return
+	if err != nil {
+		// A concurrent upload of the same sale may have won the unique index race
+		if existing, findErr := salesService.FindByClientSaleID(database.DB, orgID, clientSaleID); findErr == nil {
+			result.Status = SyncStatusAlreadyApplied
+			result.SaleID = &existing.ID
+			return result
+		}
+
+		result.Status = SyncStatusRejected
+		result.Error, result.Details = describeSaleError(err)
+		return result
 	}
 
-	// Create sale items
-	for i := range saleItems {
-		saleItems[i].SaleID = sale.ID
-		if err := tx.Create(&saleItems[i]).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale items"})
-			return
+	result.Status = SyncStatusCreated
+	result.SaleID = &sale.ID
+	result.Conflicts = len(sale.Conflicts)
+	return result
+}
+
+func parseSaleItems(orgID uuid.UUID, reqItems []SaleItemRequest) ([]services.SaleItemInput, error) {
+	items := make([]services.SaleItemInput, 0, len(reqItems))
+	for _, itemReq := range reqItems {
+		if itemReq.Barcode != "" {
+			item, err := parseScannedSaleItem(orgID, itemReq)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, *item)
+			continue
 		}
+
+		variantID, err := uuid.Parse(itemReq.VariantID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid variant ID: %s", itemReq.VariantID)
+		}
+		if itemReq.Quantity <= 0 {
+			return nil, fmt.Errorf("Invalid quantity for variant: %s", itemReq.VariantID)
+		}
+		items = append(items, services.SaleItemInput{
+			VariantID: variantID,
+			Quantity:  itemReq.Quantity,
+			Pack:      itemReq.Pack,
+		})
 	}
+	return items, nil
+}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete sale"})
-		return
+// parseScannedSaleItem resolves a sale line given by barcode. Scale barcodes supply the quantity,
+// and price-embedded ones also fix the line amount to what the scale printed.
+func parseScannedSaleItem(orgID uuid.UUID, itemReq SaleItemRequest) (*services.SaleItemInput, error) {
+	scanned, err := services.NewBarcodeService().Scan(database.DB, orgID, itemReq.Barcode)
+	var unitErr *services.ScaleUnitError
+	var precisionErr *services.QuantityPrecisionError
+	switch {
+	case errors.As(err, &unitErr):
+		return nil, fmt.Errorf("Barcode %s carries a weight but the variant is sold in %s", itemReq.Barcode, unitErr.UnitType)
+	case errors.As(err, &precisionErr):
+		return nil, fmt.Errorf("Barcode %s carries a weight finer than %s allows", itemReq.Barcode, precisionErr.UnitType)
+	case err != nil:
+		return nil, fmt.Errorf("Unknown barcode: %s", itemReq.Barcode)
 	}
 
-	// Reload with associations
-	database.DB.Preload("Items.Variant.Product").Preload("User").First(&sale, sale.ID)
-	c.JSON(http.StatusCreated, sale)
+	if scanned.Scale == nil {
+		if itemReq.Quantity <= 0 {
+			return nil, fmt.Errorf("Invalid quantity for barcode: %s", itemReq.Barcode)
+		}
+		return &services.SaleItemInput{VariantID: scanned.ID, Quantity: itemReq.Quantity, Pack: itemReq.Pack}, nil
+	}
+
+	quantity := scanned.Scale.Quantity
+	if quantity <= 0 {
+		return nil, fmt.Errorf("Invalid quantity for barcode: %s", itemReq.Barcode)
+	}
+
+	item := &services.SaleItemInput{VariantID: scanned.ID, Quantity: quantity}
+	if scanned.Scale.ValueType == models.ScaleValuePrice {
+		lineAmount := scanned.Scale.LineAmount
+		item.LineAmount = &lineAmount
+	}
+	return item, nil
+}
+
+// describeSaleError maps a SalesService error to a client-facing message and details
+func describeSaleError(err error) (string, gin.H) {
+	var stockErr *services.InsufficientStockError
+	var notFoundErr *services.VariantNotFoundError
+	var unavailableErr *services.VariantUnavailableError
+	var precisionErr *services.QuantityPrecisionError
+	switch {
+	case errors.As(err, &stockErr):
+		return "Insufficient stock", gin.H{
+			"variant_id": stockErr.VariantID.String(),
+			"available":  stockErr.Available,
+			"requested":  stockErr.Requested,
+		}
+	case errors.As(err, &precisionErr):
+		return "Quantity has more decimals than the unit allows", quantityErrorDetails(precisionErr)
+	case errors.As(err, &notFoundErr):
+		return "Variant not found: " + notFoundErr.VariantID.String(), nil
+	case errors.As(err, &unavailableErr):
+		return "Variant is not available for sale", gin.H{"variant_id": unavailableErr.VariantID.String(), "status": unavailableErr.Status}
+	case errors.Is(err, services.ErrPackNotFound):
+		return "Unknown pack unit", gin.H{"detail": err.Error()}
+	default:
+		return "Failed to process sale", nil
+	}
+}
+
+func respondSaleError(c *gin.Context, err error) {
+	message, details := describeSaleError(err)
+
+	status := http.StatusInternalServerError
+	var stockErr *services.InsufficientStockError
+	var notFoundErr *services.VariantNotFoundError
+	var unavailableErr *services.VariantUnavailableError
+	var precisionErr *services.QuantityPrecisionError
+	switch {
+	case errors.As(err, &stockErr), errors.As(err, &precisionErr), errors.Is(err, services.ErrPackNotFound):
+		status = http.StatusBadRequest
+	case errors.As(err, &notFoundErr):
+		status = http.StatusNotFound
+	case errors.As(err, &unavailableErr):
+		status = http.StatusConflict
+	}
+
+	body := gin.H{"error": message}
+	for k, v := range details {
+		body[k] = v
+	}
+	c.JSON(status, body)
 }
 
 // ListSales returns paginated sales history
@@ -182,6 +388,9 @@ func ListSales(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
 		return
 	}
+	for i := range sales {
+		signPaymentProof(&sales[i])
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"sales":       sales,
@@ -205,15 +414,19 @@ func GetSale(c *gin.Context) {
 	if err := database.DB.Where("id = ? AND organization_id = ?", saleID, orgID).
 		Preload("Items.Variant.Product").
 		Preload("User").
+		Preload("Location").
+		Preload("Conflicts").
+		Preload("Returns.Items").
 		First(&sale).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
 		return
 	}
 
+	signPaymentProof(&sale)
 	c.JSON(http.StatusOK, sale)
 }
 
-// UploadPaymentProof handles payment proof image upload
+// UploadPaymentProof stores a payment proof image or PDF for a sale and returns a signed link to it
 func UploadPaymentProof(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	saleID, err := uuid.Parse(c.Param("id"))
@@ -234,25 +447,40 @@ func UploadPaymentProof(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No image file provided"})
 		return
 	}
+	if file.Size > services.MaxPaymentProofSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payment proof is too large", "max_size": services.MaxPaymentProofSize})
+		return
+	}
 
-	// Save file locally (in production, use S3 or similar)
-	filename := fmt.Sprintf("payment_proof_%s_%s", saleID.String(), file.Filename)
-	filepath := fmt.Sprintf("./uploads/%s", filename)
+	opened, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer opened.Close()
 
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+	data, err := io.ReadAll(io.LimitReader(opened, services.MaxPaymentProofSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
 		return
 	}
 
-	// Update sale record
-	sale.PaymentProofURL = filepath
-	if err := database.DB.Save(&sale).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+	if err := services.NewSalesService().AttachPaymentProof(database.DB, &sale, file.Filename, data); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentProofTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payment proof is too large", "max_size": services.MaxPaymentProofSize})
+		case errors.Is(err, services.ErrUnsupportedPaymentProof):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Payment proof must be a JPEG, PNG or PDF"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment proof"})
+		}
 		return
 	}
 
+	signPaymentProof(&sale)
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Payment proof uploaded",
-		"url":     filepath,
+		"message":    "Payment proof uploaded",
+		"url":        sale.PaymentProofURL,
+		"expires_in": int(paymentProofURLTTL.Seconds()),
 	})
 }
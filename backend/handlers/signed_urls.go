@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"bstock/models"
+	"bstock/storage"
+	"time"
+)
+
+// Lifetimes of the signed download links returned with records
+const (
+	imageURLTTL        = time.Hour
+	paymentProofURLTTL = 15 * time.Minute
+)
+
+// signImage fills the image's signed URL and thumbnail URL
+func signImage(image *models.ProductImage) {
+	image.URL, _ = storage.Default.SignedURL(image.StorageKey, imageURLTTL)
+	image.ThumbnailURL, _ = storage.Default.SignedURL(image.ThumbnailKey, imageURLTTL)
+}
+
+// signImages signs each of the images
+func signImages(images []models.ProductImage) {
+	for i := range images {
+		signImage(&images[i])
+	}
+}
+
+// signProductImages signs the images loaded with each product
+func signProductImages(products []models.Product) {
+	for i := range products {
+		signImages(products[i].Images)
+	}
+}
+
+// signPaymentProof sets the sale's payment proof URL to a freshly signed link, or clears it when there is no proof
+func signPaymentProof(sale *models.Sale) {
+	sale.PaymentProofURL = ""
+	if sale.PaymentProofKey != "" {
+		sale.PaymentProofURL, _ = storage.Default.SignedURL(sale.PaymentProofKey, paymentProofURLTTL)
+	}
+}
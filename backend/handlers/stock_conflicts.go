@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ResolveStockConflictRequest struct {
+	Resolution      string   `json:"resolution" binding:"required,oneof=accept recount"`
+	CountedQuantity *float64 `json:"counted_quantity" binding:"omitempty,gte=0"` // Required for recount
+	Note            string   `json:"note"`
+}
+
+// ListStockConflicts returns oversell conflicts raised by synced offline sales
+func ListStockConflicts(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	status := c.DefaultQuery("status", models.ConflictStatusOpen)
+
+	query := database.DB.Where("organization_id = ?", orgID)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var conflicts []models.StockConflict
+	if err := query.
+		Preload("Variant.Product").
+		Order("created_at DESC").
+		Find(&conflicts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock conflicts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conflicts)
+}
+
+// ResolveStockConflict closes a conflict, optionally correcting the balance to a physical count
+func ResolveStockConflict(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+	conflictID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conflict ID"})
+		return
+	}
+
+	var req ResolveStockConflictRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Resolution == models.ConflictResolutionRecount && req.CountedQuantity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "counted_quantity is required for a recount"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var conflict models.StockConflict
+	if err := tx.Where("id = ? AND organization_id = ?", conflictID, orgID).
+		First(&conflict).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock conflict not found"})
+		return
+	}
+
+	if conflict.Status == models.ConflictStatusResolved {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Stock conflict already resolved"})
+		return
+	}
+
+	if req.Resolution == models.ConflictResolutionRecount {
+		inventoryService := services.NewInventoryService()
+		variant, err := inventoryService.LockVariant(tx, orgID, conflict.VariantID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			return
+		}
+
+		// The count is of one location, so it corrects that location's balance rather than the total
+		locationID, err := services.NewLocationService().ResolveLocationID(tx, orgID, conflict.LocationID)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, services.ErrLocationNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve location"})
+			return
+		}
+		level, err := inventoryService.LockStockLevel(tx, variant.ID, locationID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+			return
+		}
+
+		if delta := models.RoundQuantity(*req.CountedQuantity - level.Quantity); delta != 0 {
+			if _, err := inventoryService.ApplyStockChange(tx, variant, services.StockChange{
+				OrganizationID: orgID,
+				LocationID:     &locationID,
+				UserID:         userID,
+				Delta:          delta,
+				ReasonCode:     models.MovementReasonCorrection,
+				SourceType:     models.MovementSourceAdjustment,
+				SourceID:       &conflict.ID,
+				Note:           fmt.Sprintf("Recount resolving oversell on sale %s", conflict.SaleID),
+			}); err != nil {
+				tx.Rollback()
+				if respondQuantityError(c, err) {
+					return
+				}
+				if errors.Is(err, services.ErrNegativeStock) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+				return
+			}
+		}
+	}
+
+	now := time.Now()
+	conflict.Status = models.ConflictStatusResolved
+	conflict.Resolution = req.Resolution
+	conflict.ResolutionNote = req.Note
+	conflict.ResolvedBy = &userID
+	conflict.ResolvedAt = &now
+
+	if err := tx.Save(&conflict).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve stock conflict"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve stock conflict"})
+		return
+	}
+
+	database.DB.Preload("Variant.Product").First(&conflict, conflict.ID)
+	c.JSON(http.StatusOK, conflict)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OpenStocktakeRequest struct {
+	LocationID string `json:"location_id"` // Defaults to the user's or organization's default location
+	Category   string `json:"category"`    // Empty counts every product at the location
+	Note       string `json:"note"`
+}
+
+type StocktakeCountsRequest struct {
+	Mode  string                  `json:"mode" binding:"omitempty,oneof=set add"` // set replaces earlier counts, add accumulates them
+	Items []StocktakeCountRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type StocktakeCountRequest struct {
+	VariantID string  `json:"variant_id" binding:"required"`
+	Quantity  float64 `json:"quantity" binding:"gte=0"`
+}
+
+type CommitStocktakeRequest struct {
+	ZeroUncounted bool `json:"zero_uncounted"` // Treat variants nobody counted as out of stock
+}
+
+// ListStocktakes returns stocktake sessions, optionally filtered by status or location
+func ListStocktakes(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	query := database.DB.Where("organization_id = ?", orgID)
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	var stocktakes []models.Stocktake
+	if err := query.
+		Preload("Location").
+		Order("created_at DESC").
+		Find(&stocktakes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocktakes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stocktakes)
+}
+
+// GetStocktake returns a stocktake with its items and counts
+func GetStocktake(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	stocktakeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stocktake ID"})
+		return
+	}
+
+	var stocktake models.Stocktake
+	if err := database.DB.Where("id = ? AND organization_id = ?", stocktakeID, orgID).
+		Preload("Location").
+		Preload("Items.Variant.Product").
+		First(&stocktake).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stocktake not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stocktake)
+}
+
+// OpenStocktake starts a count session for a location, optionally limited to one category
+func OpenStocktake(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req OpenStocktakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+	location, err := services.NewLocationService().ResolveLocationID(database.DB, orgID, locationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var open int64
+	query := database.DB.Model(&models.Stocktake{}).
+		Where("organization_id = ? AND location_id = ? AND status = ?", orgID, location, models.StocktakeStatusOpen)
+	if req.Category != "" {
+		query = query.Where("category = ? OR category = ''", req.Category)
+	}
+	query.Count(&open)
+	if open > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A stocktake covering these products is already open at this location"})
+		return
+	}
+
+	stocktake := models.Stocktake{
+		OrganizationID: orgID,
+		LocationID:     location,
+		Category:       req.Category,
+		Note:           req.Note,
+		OpenedBy:       userID,
+	}
+
+	if err := services.NewStocktakeService().Open(database.DB, &stocktake); err != nil {
+		if errors.Is(err, services.ErrEmptyStocktakeScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No products to count in this scope"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open stocktake"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, stocktake)
+}
+
+// RecordStocktakeCounts stores counted quantities submitted by a counting device
+func RecordStocktakeCounts(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req StocktakeCountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts := make([]services.StocktakeCount, 0, len(req.Items))
+	for _, itemReq := range req.Items {
+		variantID, err := uuid.Parse(itemReq.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + itemReq.VariantID})
+			return
+		}
+		counts = append(counts, services.StocktakeCount{VariantID: variantID, Quantity: itemReq.Quantity})
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stocktake, ok := lockStocktake(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	if err := services.NewStocktakeService().RecordCounts(tx, stocktake, userID, counts, req.Mode == "add"); err != nil {
+		tx.Rollback()
+		respondStocktakeError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record counts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Counts recorded", "items": len(counts)})
+}
+
+// GetStocktakeVariance compares counted against system quantities and values the difference at cost
+func GetStocktakeVariance(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	stocktakeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stocktake ID"})
+		return
+	}
+
+	var stocktake models.Stocktake
+	if err := database.DB.Where("id = ? AND organization_id = ?", stocktakeID, orgID).
+		Preload("Items.Variant.Product").
+		First(&stocktake).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stocktake not found"})
+		return
+	}
+
+	report, err := services.NewStocktakeService().Variance(database.DB, &stocktake)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute variance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CommitStocktake posts all variances as stock adjustments in one transaction
+func CommitStocktake(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req CommitStocktakeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stocktake, ok := lockStocktake(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	stocktakeService := services.NewStocktakeService()
+	if err := stocktakeService.Commit(tx, stocktake, userID, req.ZeroUncounted); err != nil {
+		tx.Rollback()
+		respondStocktakeError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit stocktake"})
+		return
+	}
+
+	var committed models.Stocktake
+	database.DB.Preload("Items.Variant.Product").First(&committed, stocktake.ID)
+	report, err := stocktakeService.Variance(database.DB, &committed)
+	if err != nil {
+		c.JSON(http.StatusOK, stocktake)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CancelStocktake abandons an open stocktake without touching stock
+func CancelStocktake(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	stocktakeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stocktake ID"})
+		return
+	}
+
+	result := database.DB.Model(&models.Stocktake{}).
+		Where("id = ? AND organization_id = ? AND status = ?", stocktakeID, orgID, models.StocktakeStatusOpen).
+		Update("status", models.StocktakeStatusCancelled)
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel stocktake"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only open stocktakes can be cancelled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stocktake cancelled"})
+}
+
+// lockStocktake loads the stocktake named in the route with its items and locks it for the rest of tx
+func lockStocktake(c *gin.Context, tx *gorm.DB) (*models.Stocktake, bool) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	stocktakeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stocktake ID"})
+		return nil, false
+	}
+
+	var stocktake models.Stocktake
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND organization_id = ?", stocktakeID, orgID).
+		Preload("Items").
+		First(&stocktake).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stocktake not found"})
+		return nil, false
+	}
+
+	if !ensureLocationAccess(c, stocktake.LocationID) {
+		return nil, false
+	}
+
+	return &stocktake, true
+}
+
+func respondStocktakeError(c *gin.Context, err error) {
+	if respondQuantityError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrStocktakeStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "Stocktake is no longer open"})
+	case errors.Is(err, services.ErrVariantNotInScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process stocktake"})
+	}
+}
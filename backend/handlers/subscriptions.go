@@ -59,9 +59,10 @@ func GetCurrentSubscription(c *gin.Context) {
 	}
 
 	// Get usage stats
-	var productCount, userCount int64
-	database.DB.Model(&models.Product{}).Where("organization_id = ?", orgID).Count(&productCount)
+	var productCount, userCount, locationCount int64
+	database.DB.Model(&models.Product{}).Where("organization_id = ? AND status = ?", orgID, models.CatalogStatusActive).Count(&productCount)
 	database.DB.Model(&models.OrganizationUser{}).Where("organization_id = ?", orgID).Count(&userCount)
+	database.DB.Model(&models.Location{}).Where("organization_id = ?", orgID).Count(&locationCount)
 
 	c.JSON(http.StatusOK, gin.H{
 		"subscription": subscription,
@@ -74,6 +75,10 @@ func GetCurrentSubscription(c *gin.Context) {
 				"current": userCount,
 				"limit":   subscription.Plan.UserLimit,
 			},
+			"locations": gin.H{
+				"current": locationCount,
+				"limit":   subscription.Plan.LocationLimit,
+			},
 		},
 	})
 }
@@ -143,9 +148,9 @@ func validateDowngrade(orgID uuid.UUID, newPlan *models.Plan) error {
 	// Check product count
 	if newPlan.ProductLimit != nil {
 		var productCount int64
-		database.DB.Model(&models.Product{}).Where("organization_id = ?", orgID).Count(&productCount)
+		database.DB.Model(&models.Product{}).Where("organization_id = ? AND status = ?", orgID, models.CatalogStatusActive).Count(&productCount)
 		if productCount > int64(*newPlan.ProductLimit) {
-			return fmt.Errorf("cannot downgrade: you have %d products but new plan allows only %d", productCount, *newPlan.ProductLimit)
+			return fmt.Errorf("cannot downgrade: you have %d active products but new plan allows only %d", productCount, *newPlan.ProductLimit)
 		}
 	}
 
@@ -158,6 +163,15 @@ func validateDowngrade(orgID uuid.UUID, newPlan *models.Plan) error {
 		}
 	}
 
+	// Check location count
+	if newPlan.LocationLimit != nil {
+		var locationCount int64
+		database.DB.Model(&models.Location{}).Where("organization_id = ?", orgID).Count(&locationCount)
+		if locationCount > int64(*newPlan.LocationLimit) {
+			return fmt.Errorf("cannot downgrade: you have %d locations but new plan allows only %d", locationCount, *newPlan.LocationLimit)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SyncCatalog returns the catalog changes an offline POS needs since the cursor it got last time
+// (?since=), or the whole active catalog on first sync. Stock levels cover the caller's assigned
+// location, or ?location_id= when given, or every location.
+func SyncCatalog(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	locationID, ok := resolveRequestLocation(c, c.Query("location_id"))
+	if !ok {
+		return
+	}
+
+	changes, err := services.NewSyncService().CatalogChanges(database.DB, orgID, c.Query("since"), locationID)
+	if errors.Is(err, services.ErrInvalidSyncCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync cursor; sync again without since"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync catalog"})
+		return
+	}
+	signProductImages(changes.Products)
+
+	c.JSON(http.StatusOK, changes)
+}
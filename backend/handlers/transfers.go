@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"bstock/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreateTransferRequest struct {
+	SourceLocationID      string                `json:"source_location_id" binding:"required"`
+	DestinationLocationID string                `json:"destination_location_id" binding:"required"`
+	Note                  string                `json:"note"`
+	Items                 []TransferItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type TransferItemRequest struct {
+	VariantID string  `json:"variant_id" binding:"required"`
+	Quantity  float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+type ReceiveTransferRequest struct {
+	Items []ReceiveTransferItemRequest `json:"items" binding:"omitempty,dive"` // Omitted lines are fully received
+}
+
+type ReceiveTransferItemRequest struct {
+	VariantID        string  `json:"variant_id" binding:"required"`
+	QuantityReceived float64 `json:"quantity_received" binding:"gte=0"`
+}
+
+// ListTransfers returns stock transfers, optionally filtered by status or location
+func ListTransfers(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	// Staff assigned to a location only see transfers into or out of it
+	locationID, ok := resolveRequestLocation(c, c.Query("location_id"))
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("organization_id = ?", orgID)
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if locationID != nil {
+		query = query.Where("source_location_id = ? OR destination_location_id = ?", *locationID, *locationID)
+	}
+
+	var transfers []models.StockTransfer
+	if err := query.
+		Preload("SourceLocation").
+		Preload("DestinationLocation").
+		Preload("Items").
+		Order("created_at DESC").
+		Find(&transfers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// GetTransfer returns a single transfer with its lines
+func GetTransfer(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	var transfer models.StockTransfer
+	if err := database.DB.Where("id = ? AND organization_id = ?", transferID, orgID).
+		Preload("SourceLocation").
+		Preload("DestinationLocation").
+		Preload("Items.Variant.Product").
+		First(&transfer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// CreateTransfer drafts a transfer between two locations. Stock moves only on dispatch.
+func CreateTransfer(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req CreateTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sourceID, err := uuid.Parse(req.SourceLocationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source location ID"})
+		return
+	}
+	destinationID, err := uuid.Parse(req.DestinationLocationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid destination location ID"})
+		return
+	}
+	if sourceID == destinationID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination must be different locations"})
+		return
+	}
+
+	locationService := services.NewLocationService()
+	if _, err := locationService.GetLocation(database.DB, orgID, sourceID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source location not found"})
+		return
+	}
+	if _, err := locationService.GetLocation(database.DB, orgID, destinationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Destination location not found"})
+		return
+	}
+	if !ensureLocationAccess(c, sourceID) {
+		return
+	}
+
+	transfer := models.StockTransfer{
+		OrganizationID:        orgID,
+		SourceLocationID:      sourceID,
+		DestinationLocationID: destinationID,
+		Status:                models.TransferStatusDraft,
+		Note:                  req.Note,
+		CreatedBy:             userID,
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Items))
+	for _, itemReq := range req.Items {
+		variantID, err := uuid.Parse(itemReq.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + itemReq.VariantID})
+			return
+		}
+		if seen[variantID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate variant on transfer: " + itemReq.VariantID})
+			return
+		}
+		seen[variantID] = true
+
+		var count int64
+		database.DB.Model(&models.Variant{}).
+			Joins("JOIN products ON products.id = variants.product_id").
+			Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found: " + itemReq.VariantID})
+			return
+		}
+
+		transfer.Items = append(transfer.Items, models.StockTransferItem{
+			VariantID: variantID,
+			Quantity:  itemReq.Quantity,
+		})
+	}
+
+	if err := database.DB.Create(&transfer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// DispatchTransfer deducts the transfer's goods from the source location
+func DispatchTransfer(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	transfer, ok := lockTransfer(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+	if !ensureLocationAccess(c, transfer.SourceLocationID) {
+		tx.Rollback()
+		return
+	}
+
+	if err := services.NewTransferService().Dispatch(tx, transfer, userID); err != nil {
+		tx.Rollback()
+		respondTransferError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dispatch transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// ReceiveTransfer adds the received goods at the destination and records any discrepancy
+func ReceiveTransfer(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req ReceiveTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	received := make(map[uuid.UUID]float64, len(req.Items))
+	for _, itemReq := range req.Items {
+		variantID, err := uuid.Parse(itemReq.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID: " + itemReq.VariantID})
+			return
+		}
+		received[variantID] = itemReq.QuantityReceived
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	transfer, ok := lockTransfer(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+	if !ensureLocationAccess(c, transfer.DestinationLocationID) {
+		tx.Rollback()
+		return
+	}
+
+	if err := services.NewTransferService().Receive(tx, transfer, userID, received); err != nil {
+		tx.Rollback()
+		respondTransferError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// CancelTransfer abandons a transfer that has not been dispatched yet
+func CancelTransfer(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	result := database.DB.Model(&models.StockTransfer{}).
+		Where("id = ? AND organization_id = ? AND status = ?", transferID, orgID, models.TransferStatusDraft).
+		Update("status", models.TransferStatusCancelled)
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transfer"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft transfers can be cancelled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled"})
+}
+
+// lockTransfer loads the transfer named in the route with its lines and locks it for the rest of tx
+func lockTransfer(c *gin.Context, tx *gorm.DB) (*models.StockTransfer, bool) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return nil, false
+	}
+
+	var transfer models.StockTransfer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND organization_id = ?", transferID, orgID).
+		Preload("Items").
+		First(&transfer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return nil, false
+	}
+
+	return &transfer, true
+}
+
+func respondTransferError(c *gin.Context, err error) {
+	if respondQuantityError(c, err) {
+		return
+	}
+
+	var stockErr *services.TransferStockError
+	switch {
+	case errors.As(err, &stockErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Insufficient stock at source location",
+			"variant_id": stockErr.VariantID.String(),
+			"available":  stockErr.Available,
+			"requested":  stockErr.Requested,
+		})
+	case errors.Is(err, services.ErrTransferStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "Transfer is not in a valid status for this action"})
+	case errors.Is(err, services.ErrInvalidReceivedQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process transfer"})
+	}
+}
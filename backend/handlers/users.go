@@ -3,6 +3,7 @@ package handlers
 import (
 	"bstock/database"
 	"bstock/models"
+	"bstock/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"net/http"
@@ -12,6 +13,7 @@ type InviteUserRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
 	Password    string `json:"password" binding:"required,min=6"`
 	Role        string `json:"role" binding:"required,oneof=owner cashier"`
+	LocationID  string `json:"location_id"` // Restricts the user to one location
 }
 
 func ListUsers(c *gin.Context) {
@@ -78,6 +80,21 @@ func InviteUser(c *gin.Context) {
 		OrganizationID: orgID,
 		Role:           req.Role,
 	}
+
+	if req.LocationID != "" {
+		locationID, err := uuid.Parse(req.LocationID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		if _, err := services.NewLocationService().GetLocation(tx, orgID, locationID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		orgUser.LocationID = &locationID
+	}
 	if err := tx.Create(&orgUser).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to organization"})
@@ -131,3 +148,54 @@ func RemoveUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "User removed successfully"})
 }
+
+type UpdateUserLocationRequest struct {
+	LocationID *string `json:"location_id"` // null to let the user work at any location
+}
+
+// UpdateUserLocation assigns a member to a single location, or clears the assignment
+func UpdateUserLocation(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateUserLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var orgUser models.OrganizationUser
+	if err := database.DB.Where("user_id = ? AND organization_id = ?", userID, orgID).
+		First(&orgUser).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found in organization"})
+		return
+	}
+
+	var locationID *uuid.UUID
+	if req.LocationID != nil {
+		parsed, err := uuid.Parse(*req.LocationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		if _, err := services.NewLocationService().GetLocation(database.DB, orgID, parsed); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		locationID = &parsed
+	}
+
+	if err := database.DB.Model(&orgUser).Update("location_id", locationID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user location"})
+		return
+	}
+
+	// Takes effect on the user's next login
+	orgUser.LocationID = locationID
+	database.DB.Preload("User").First(&orgUser, orgUser.ID)
+	c.JSON(http.StatusOK, orgUser)
+}
@@ -2,41 +2,373 @@ package handlers
 
 import (
 	"bstock/database"
+	"bstock/events"
 	"bstock/models"
+	"bstock/services"
+	"bstock/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"net/http"
+	"gorm.io/gorm"
 )
 
+// maxMovementPageSize caps how many stock movements one page may return
+const maxMovementPageSize = 200
+
 type UpdateVariantRequest struct {
-	PurchasePrice *float64 `json:"purchase_price"`
-	SalePrice     *float64 `json:"sale_price"`
-	Quantity      *int     `json:"quantity"`
-	MinStockLevel *int     `json:"min_stock_level"`
-	SKU           *string  `json:"sku"`
-	UnitType      *string  `json:"unit_type"`
+	PurchasePrice *float64           `json:"purchase_price"` // Under weighted-average costing, accepted only if unchanged
+	SalePrice     *float64           `json:"sale_price"`
+	Quantity      *float64           `json:"quantity"` // Accepted only if unchanged; stock moves through adjust-stock and other movements
+	MinStockLevel *float64           `json:"min_stock_level"`
+	SKU           *string            `json:"sku"`
+	PLU           *string            `json:"plu"`
+	UnitType      *string            `json:"unit_type"`
+	Attributes    *map[string]string `json:"attributes"` // Checked against the product's attribute definitions
+	Status        *string            `json:"status" binding:"omitempty,oneof=active draft"`
+	Barcodes      *[]string          `json:"barcodes"`                       // Replaces all of the variant's barcodes when present
+	Packs         *[]PackUnitRequest `json:"packs" binding:"omitempty,dive"` // Replaces all of the variant's pack units when present
 }
 
 type StockAdjustmentRequest struct {
-	Adjustment int    `json:"adjustment" binding:"required"` // Can be positive or negative
-	Reason     string `json:"reason"`
+	Adjustment float64  `json:"adjustment" binding:"required"` // Can be positive or negative
+	ReasonCode string   `json:"reason_code" binding:"omitempty,oneof=restock damage theft correction"`
+	Reason     string   `json:"reason"`                              // Free-text note stored on the movement
+	LocationID string   `json:"location_id"`                         // Defaults to the user's or organization's default location
+	UnitCost   *float64 `json:"unit_cost" binding:"omitempty,gte=0"` // Cost of restocked goods, defaults to current cost
+	Pack       string   `json:"pack"`                                // Pack unit the adjustment and cost are given in
 }
 
-// UpdateVariant updates a variant's details
-func UpdateVariant(c *gin.Context) {
+type AddVariantRequest struct {
+	CreateVariantRequest
+	LocationID string `json:"location_id"` // Where opening stock is held
+}
+
+type ReorderVariantsRequest struct {
+	VariantIDs []uuid.UUID `json:"variant_ids" binding:"required,min=1"`
+}
+
+// CreateVariant adds a variant to an existing product, after its current variants
+func CreateVariant(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req AddVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
+		First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	position, err := services.NewVariantService().NextPosition(tx, product.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		return
+	}
+
+	variant, ok := createVariant(c, tx, orgID, userID, product.ID, locationID, req.CreateVariantRequest, position)
+	if !ok {
+		return
+	}
+
+	if err := events.PublishVariant(tx, orgID, variant, events.ActionCreated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		return
+	}
+
+	database.DB.Preload("Barcodes").Preload("Packs").Preload("StockLevels").First(variant, variant.ID)
+	c.JSON(http.StatusCreated, variant)
+}
+
+// createVariant creates a variant with its packs, barcodes and opening stock inside tx.
+// On failure it rolls tx back, writes the response and returns false.
+func createVariant(c *gin.Context, tx *gorm.DB, orgID, userID, productID uuid.UUID, locationID *uuid.UUID, req CreateVariantRequest, position int) (*models.Variant, bool) {
+	inventoryService := services.NewInventoryService()
+	barcodeService := services.NewBarcodeService()
+
+	if err := barcodeService.ValidatePLU(tx, orgID, uuid.Nil, req.PLU); err != nil {
+		tx.Rollback()
+		respondBarcodeError(c, err)
+		return nil, false
+	}
+
+	attributes, err := services.NewAttributeService().ValidateVariantAttributes(tx, productID, uuid.Nil, req.Attributes)
+	if err != nil {
+		tx.Rollback()
+		if !respondAttributeError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate attributes"})
+		}
+		return nil, false
+	}
+
+	variant := models.Variant{
+		ProductID:     productID,
+		Attributes:    attributes,
+		SKU:           req.SKU,
+		PLU:           req.PLU,
+		PurchasePrice: req.PurchasePrice,
+		SalePrice:     req.SalePrice,
+		MinStockLevel: req.MinStockLevel,
+		UnitType:      req.UnitType,
+		Position:      position,
+		Status:        req.Status,
+	}
+
+	if variant.UnitType == "" {
+		variant.UnitType = "pcs"
+	}
+	if variant.Status == "" {
+		variant.Status = models.CatalogStatusActive
+	}
+
+	if err := tx.Create(&variant).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create variant: " + err.Error()})
+		return nil, false
+	}
+
+	if len(req.Packs) > 0 {
+		if _, err := inventoryService.SetPacks(tx, variant.ID, packUnits(req.Packs)); err != nil {
+			tx.Rollback()
+			respondPackError(c, err)
+			return nil, false
+		}
+	}
+
+	if len(req.Barcodes) > 0 {
+		if _, err := barcodeService.SetBarcodes(tx, orgID, variant.ID, req.Barcodes); err != nil {
+			tx.Rollback()
+			respondBarcodeError(c, err)
+			return nil, false
+		}
+	}
+
+	if req.Quantity != 0 {
+		if _, err := inventoryService.ApplyStockChange(tx, &variant, services.StockChange{
+			OrganizationID: orgID,
+			LocationID:     locationID,
+			UserID:         userID,
+			Delta:          req.Quantity,
+			ReasonCode:     models.MovementReasonInitial,
+			SourceType:     models.MovementSourceAdjustment,
+			Note:           "Opening stock",
+		}); err != nil {
+			tx.Rollback()
+			if respondQuantityError(c, err) {
+				return nil, false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record opening stock"})
+			return nil, false
+		}
+	}
+
+	return &variant, true
+}
+
+// DeleteVariant removes a variant. Variants with stock or history are archived instead of deleted.
+func DeleteVariant(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	var images []models.ProductImage
+	deleted := changeVariantLifecycle(c, func(tx *gorm.DB, variant *models.Variant) (gin.H, error) {
+		if err := tx.Where("variant_id = ?", variant.ID).Find(&images).Error; err != nil {
+			return nil, err
+		}
+
+		archived, err := services.NewVariantService().Remove(tx, variant)
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			images = nil
+			if err := events.PublishVariant(tx, orgID, variant, events.ActionUpdated); err != nil {
+				return nil, err
+			}
+			return gin.H{"message": "Variant has history and was archived", "archived": true, "variant": variant}, nil
+		}
+		if err := events.PublishVariant(tx, orgID, variant, events.ActionDeleted); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Variant deleted successfully", "archived": false}, nil
+	})
+
+	// Files go only once the rows are gone for good
+	if deleted {
+		services.NewImageService().DeleteFiles(images)
+	}
+}
+
+// ArchiveVariant retires a variant so it can no longer be sold
+func ArchiveVariant(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	changeVariantLifecycle(c, func(tx *gorm.DB, variant *models.Variant) (gin.H, error) {
+		if err := services.NewVariantService().Archive(tx, variant); err != nil {
+			return nil, err
+		}
+		if err := events.PublishVariant(tx, orgID, variant, events.ActionUpdated); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Variant archived", "variant": variant}, nil
+	})
+}
+
+// RestoreVariant brings an archived variant back into the catalog
+func RestoreVariant(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	changeVariantLifecycle(c, func(tx *gorm.DB, variant *models.Variant) (gin.H, error) {
+		if err := services.NewVariantService().Restore(tx, variant); err != nil {
+			return nil, err
+		}
+		if err := events.PublishVariant(tx, orgID, variant, events.ActionUpdated); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Variant restored", "variant": variant}, nil
+	})
+}
+
+// changeVariantLifecycle locks the variant in the URL and applies change to it in a transaction.
+// It reports whether the change was committed.
+func changeVariantLifecycle(c *gin.Context, change func(tx *gorm.DB, variant *models.Variant) (gin.H, error)) bool {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	variantID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
-		return
+		return false
 	}
 
-	// Verify variant belongs to organization
-	var variant models.Variant
-	if err := database.DB.Joins("JOIN products ON products.id = variants.product_id").
-		Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
-		First(&variant).Error; err != nil {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	variant, err := services.NewInventoryService().LockVariant(tx, orgID, variantID)
+	if err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return false
+	}
+
+	response, err := change(tx, variant)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, services.ErrLastVariant) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A product must keep at least one variant that is not archived"})
+			return false
+		}
+		if respondAttributeError(c, err) {
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return false
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return false
+	}
+
+	c.JSON(http.StatusOK, response)
+	return true
+}
+
+// ReorderVariants sets the display order of a product's variants that are not archived
+func ReorderVariants(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req ReorderVariantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND organization_id = ?", productID, orgID).
+		First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := services.NewVariantService().Reorder(tx, product.ID, req.VariantIDs); err != nil {
+		tx.Rollback()
+		if errors.Is(err, services.ErrVariantOrderMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "variant_ids must list each variant of the product that is not archived exactly once"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder variants"})
+		return
+	}
+	if err := events.PublishProduct(tx, &product, events.ActionUpdated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder variants"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder variants"})
+		return
+	}
+
+	var variants []models.Variant
+	database.DB.Where("product_id = ?", product.ID).Scopes(currentVariants).Find(&variants)
+	c.JSON(http.StatusOK, variants)
+}
+
+// UpdateVariant updates a variant's details. The variant's ETag must be sent as If-Match; the
+// update is refused with 409 if someone else changed the variant in the meantime.
+func UpdateVariant(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+	if !requireIfMatch(c) {
 		return
 	}
 
@@ -46,35 +378,258 @@ func UpdateVariant(c *gin.Context) {
 		return
 	}
 
-	if req.PurchasePrice != nil {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Verify variant belongs to organization
+	inventoryService := services.NewInventoryService()
+	variant, err := inventoryService.LockVariant(tx, orgID, variantID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	if !ifMatch(c, variant.Version) {
+		tx.Rollback()
+		respondVariantConflict(c, variant.ID)
+		return
+	}
+	version := variant.Version
+
+	// Clients may echo the quantity they read, but stock is only changed by recorded movements
+	if req.Quantity != nil && *req.Quantity != variant.Quantity {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Quantity can't be set directly; record a stock adjustment with POST /variants/:id/adjust-stock",
+			"quantity": variant.Quantity,
+		})
+		return
+	}
+
+	if req.PurchasePrice != nil && *req.PurchasePrice != variant.PurchasePrice {
+		// The weighted average is the value of the stock on hand, so it only moves with recorded receipts
+		method, err := inventoryService.CostingMethod(tx, orgID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+			return
+		}
+		if method == models.CostingMethodWeightedAverage {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":          "Purchase price is the weighted average cost; record a restock with a unit_cost through POST /variants/:id/adjust-stock",
+				"purchase_price": variant.PurchasePrice,
+			})
+			return
+		}
 		variant.PurchasePrice = *req.PurchasePrice
 	}
 	if req.SalePrice != nil {
 		variant.SalePrice = *req.SalePrice
 	}
-	if req.Quantity != nil {
-		variant.Quantity = *req.Quantity
-	}
 	if req.MinStockLevel != nil {
 		variant.MinStockLevel = *req.MinStockLevel
 	}
 	if req.SKU != nil {
 		variant.SKU = *req.SKU
 	}
-	if req.UnitType != nil {
+	if req.UnitType != nil && *req.UnitType != variant.UnitType {
+		var packs []models.PackUnit
+		if req.Packs != nil {
+			packs = packUnits(*req.Packs)
+		}
+		if err := services.NewVariantService().ValidateUnitChange(tx, variant, *req.UnitType, packs); err != nil {
+			tx.Rollback()
+			respondUnitChangeError(c, err)
+			return
+		}
 		variant.UnitType = *req.UnitType
 	}
+	if req.Status != nil && *req.Status != variant.Status {
+		if variant.Status == models.CatalogStatusArchived {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "Archived variants must be restored first"})
+			return
+		}
+		variant.Status = *req.Status
+	}
+	if req.Attributes != nil {
+		attributes, err := services.NewAttributeService().ValidateVariantAttributes(tx, variant.ProductID, variant.ID, *req.Attributes)
+		if err != nil {
+			tx.Rollback()
+			if !respondAttributeError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate attributes"})
+			}
+			return
+		}
+		variant.Attributes = attributes
+	}
+	if req.PLU != nil {
+		if err := services.NewBarcodeService().ValidatePLU(tx, orgID, variant.ID, *req.PLU); err != nil {
+			tx.Rollback()
+			respondBarcodeError(c, err)
+			return
+		}
+		variant.PLU = *req.PLU
+	}
+
+	err = services.NewVariantService().Update(tx, variant, version)
+	if errors.Is(err, services.ErrVersionConflict) {
+		tx.Rollback()
+		respondVariantConflict(c, variant.ID)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return
+	}
+
+	if req.Barcodes != nil {
+		barcodes, err := services.NewBarcodeService().SetBarcodes(tx, orgID, variant.ID, *req.Barcodes)
+		if err != nil {
+			tx.Rollback()
+			respondBarcodeError(c, err)
+			return
+		}
+		variant.Barcodes = barcodes
+	}
+
+	if req.Packs != nil {
+		packs, err := inventoryService.SetPacks(tx, variant.ID, packUnits(*req.Packs))
+		if err != nil {
+			tx.Rollback()
+			respondPackError(c, err)
+			return
+		}
+		variant.Packs = packs
+	}
+
+	if err := events.PublishVariant(tx, orgID, variant, events.ActionUpdated); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return
+	}
 
-	if err := database.DB.Save(&variant).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
 		return
 	}
 
+	c.Header("ETag", etag(variant.Version))
 	c.JSON(http.StatusOK, variant)
 }
 
-// AdjustStock adjusts the stock quantity of a variant
+// respondVariantConflict responds 409 with the variant as it now stands, so the client can merge and retry
+func respondVariantConflict(c *gin.Context, variantID uuid.UUID) {
+	var current models.Variant
+	if err := database.DB.Preload("Barcodes").Preload("Packs").First(&current, variantID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+		return
+	}
+	c.Header("ETag", etag(current.Version))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "Variant was changed by someone else; review the current version and retry",
+		"current": current,
+	})
+}
+
+// AdjustStock adjusts the stock quantity of a variant and records the movement
 func AdjustStock(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+	userID := c.MustGet("user_id").(uuid.UUID)
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var req StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	locationID, ok := resolveRequestLocation(c, req.LocationID)
+	if !ok {
+		return
+	}
+
+	reasonCode := req.ReasonCode
+	if reasonCode == "" {
+		reasonCode = models.MovementReasonCorrection
+		if req.Adjustment > 0 {
+			reasonCode = models.MovementReasonRestock
+		}
+	}
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	inventoryService := services.NewInventoryService()
+	variant, err := inventoryService.LockVariant(tx, orgID, variantID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	adjustment, unitCost := req.Adjustment, req.UnitCost
+	if req.Pack != "" {
+		pack, err := inventoryService.FindPack(tx, variant.ID, req.Pack)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown pack unit: " + req.Pack})
+			return
+		}
+		adjustment = pack.BaseQuantity(adjustment)
+		if unitCost != nil {
+			baseCost := pack.BaseUnitCost(*unitCost)
+			unitCost = &baseCost
+		}
+	}
+
+	if _, err := inventoryService.ApplyStockChange(tx, variant, services.StockChange{
+		OrganizationID: orgID,
+		LocationID:     locationID,
+		UserID:         userID,
+		Delta:          adjustment,
+		ReasonCode:     reasonCode,
+		SourceType:     models.MovementSourceAdjustment,
+		Note:           req.Reason,
+		UnitCost:       unitCost,
+	}); err != nil {
+		tx.Rollback()
+		if respondQuantityError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrNegativeStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// GetVariantMovements returns the paginated stock movement history of a variant
+func GetVariantMovements(c *gin.Context) {
 	orgID := c.MustGet("organization_id").(uuid.UUID)
 	variantID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -90,26 +645,70 @@ func AdjustStock(c *gin.Context) {
 		return
 	}
 
-	var req StockAdjustmentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// Pagination
+	page := 1
+	limit := 50
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
 	}
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxMovementPageSize {
+		limit = maxMovementPageSize
+	}
+	offset := (page - 1) * limit
 
-	newQuantity := variant.Quantity + req.Adjustment
-	if newQuantity < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
-		return
+	query := database.DB.Where("organization_id = ? AND variant_id = ?", orgID, variantID)
+
+	if reasonCode := c.Query("reason_code"); reasonCode != "" {
+		query = query.Where("reason_code = ?", reasonCode)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return
+		}
+		query = query.Where("created_at >= ?", start)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		end, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+			return
+		}
+		query = query.Where("created_at <= ?", end.Add(24*time.Hour))
 	}
 
-	variant.Quantity = newQuantity
+	var movements []models.StockMovement
+	var total int64
 
-	if err := database.DB.Save(&variant).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+	query.Model(&models.StockMovement{}).Count(&total)
+	if err := query.
+		Preload("User").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
 		return
 	}
 
-	c.JSON(http.StatusOK, variant)
+	c.JSON(http.StatusOK, gin.H{
+		"variant":     variant,
+		"movements":   movements,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
 }
 
 // GetLowStockAlerts returns all variants below minimum stock level
@@ -120,6 +719,7 @@ func GetLowStockAlerts(c *gin.Context) {
 	if err := database.DB.
 		Joins("JOIN products ON products.id = variants.product_id").
 		Where("products.organization_id = ? AND variants.quantity <= variants.min_stock_level", orgID).
+		Where("variants.status = ? AND products.status = ?", models.CatalogStatusActive, models.CatalogStatusActive).
 		Preload("Product").
 		Find(&variants).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low stock items"})
@@ -128,3 +728,99 @@ func GetLowStockAlerts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, variants)
 }
+
+// GetVariantByBarcode looks up the variant carrying a scanned barcode, with its product and current stock.
+// Scale barcodes also return the weight or price they carry.
+func GetVariantByBarcode(c *gin.Context) {
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	variant, err := services.NewBarcodeService().Scan(database.DB, orgID, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, utils.ErrInvalidBarcode) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No variant with this barcode"})
+			return
+		}
+		var unitErr *services.ScaleUnitError
+		if errors.As(err, &unitErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Barcode carries a weight but the variant is not sold by weight",
+				"variant_id": unitErr.VariantID.String(),
+				"unit_type":  unitErr.UnitType,
+			})
+			return
+		}
+		if respondQuantityError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up barcode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+func respondBarcodeError(c *gin.Context, err error) {
+	var inUseErr *services.BarcodeInUseError
+	switch {
+	case errors.Is(err, utils.ErrInvalidBarcode), errors.Is(err, services.ErrInvalidPLU):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPLUInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "PLU is already assigned to another variant"})
+	case errors.As(err, &inUseErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Barcode is already assigned to another variant",
+			"code":       inUseErr.Code,
+			"variant_id": inUseErr.VariantID.String(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save barcodes"})
+	}
+}
+
+// respondQuantityError answers a quantity finer than the variant's unit allows and reports whether it did
+func respondQuantityError(c *gin.Context, err error) bool {
+	var precisionErr *services.QuantityPrecisionError
+	if !errors.As(err, &precisionErr) {
+		return false
+	}
+
+	body := gin.H{"error": "Quantity has more decimals than the unit allows"}
+	for k, v := range quantityErrorDetails(precisionErr) {
+		body[k] = v
+	}
+	c.JSON(http.StatusBadRequest, body)
+	return true
+}
+
+// respondUnitChangeError answers a unit change that was refused by ValidateUnitChange
+func respondUnitChangeError(c *gin.Context, err error) {
+	var unitErr *services.UnitChangeError
+	switch {
+	case errors.Is(err, services.ErrUnknownUnit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown unit type", "units": models.UnitPrecisions()})
+	case errors.As(err, &unitErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "The variant holds quantities the new unit can't represent",
+			"unit_type": unitErr.UnitType,
+			"field":     unitErr.Field,
+			"quantity":  unitErr.Quantity,
+			"precision": models.QuantityPrecision(unitErr.UnitType),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update variant"})
+	}
+}
+
+func quantityErrorDetails(err *services.QuantityPrecisionError) gin.H {
+	return gin.H{
+		"variant_id": err.VariantID.String(),
+		"unit_type":  err.UnitType,
+		"quantity":   err.Quantity,
+		"precision":  models.QuantityPrecision(err.UnitType),
+	}
+}
+
+// ListUnits returns how many decimals quantities may carry in each unit type
+func ListUnits(c *gin.Context) {
+	c.JSON(http.StatusOK, models.UnitPrecisions())
+}
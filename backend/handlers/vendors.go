@@ -3,8 +3,11 @@ package handlers
 import (
 	"bstock/database"
 	"bstock/models"
+	"bstock/services"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"net/http"
 )
 
@@ -56,16 +59,24 @@ func DeleteVendor(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Where("id = ? AND organization_id = ?", vendorID, orgID).
-		Delete(&models.Vendor{})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND organization_id = ?", vendorID, orgID).
+			Delete(&models.Vendor{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return services.NewSyncService().RecordDeleted(tx, orgID, models.TombstoneVendor, vendorID)
+	})
 
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vendor"})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor not found"})
 		return
 	}
-
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vendor"})
 		return
 	}
 
@@ -28,6 +28,25 @@ func AuthRequired() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("organization_id", claims.OrganizationID)
 		c.Set("role", claims.Role)
+		if claims.LocationID != nil {
+			c.Set("location_id", *claims.LocationID)
+		}
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// TokenFromQuery lets clients that cannot set headers, such as a browser EventSource, pass the JWT as ?token=.
+// Use it only on streaming routes, since URLs end up in access logs.
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
 		c.Next()
 	}
 }
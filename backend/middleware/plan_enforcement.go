@@ -51,7 +51,7 @@ func RequireAnalytics() gin.HandlerFunc {
 	}
 }
 
-// CheckProductLimit verifies if organization can add more products
+// CheckProductLimit verifies if organization can add more active products. Drafts and archived products don't count.
 func CheckProductLimit(c *gin.Context) {
 	plan, err := GetCurrentPlan(c)
 	if err != nil {
@@ -70,7 +70,7 @@ func CheckProductLimit(c *gin.Context) {
 
 	var count int64
 	if err := database.DB.Model(&models.Product{}).
-		Where("organization_id = ?", orgID).
+		Where("organization_id = ? AND status = ?", orgID, models.CatalogStatusActive).
 		Count(&count).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count products"})
 		c.Abort()
@@ -130,3 +130,43 @@ func CheckUserLimit(c *gin.Context) {
 
 	c.Next()
 }
+
+// CheckLocationLimit verifies if organization can add more locations
+func CheckLocationLimit(c *gin.Context) {
+	plan, err := GetCurrentPlan(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve plan"})
+		c.Abort()
+		return
+	}
+
+	// Unlimited locations
+	if plan.LocationLimit == nil {
+		c.Next()
+		return
+	}
+
+	orgID := c.MustGet("organization_id").(uuid.UUID)
+
+	var count int64
+	if err := database.DB.Model(&models.Location{}).
+		Where("organization_id = ?", orgID).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count locations"})
+		c.Abort()
+		return
+	}
+
+	if count >= int64(*plan.LocationLimit) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Location limit reached for your current plan",
+			"limit":            *plan.LocationLimit,
+			"current_count":    count,
+			"upgrade_required": true,
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
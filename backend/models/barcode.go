@@ -0,0 +1,12 @@
+package models
+
+import "github.com/google/uuid"
+
+// Barcode is one of a variant's scannable codes. Codes are unique within an organization.
+type Barcode struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"not null;uniqueIndex:idx_barcodes_org_code" json:"organization_id"`
+	VariantID      uuid.UUID `gorm:"not null;index" json:"variant_id"`
+	Code           string    `gorm:"not null;uniqueIndex:idx_barcodes_org_code" json:"code"`
+	Symbology      string    `gorm:"not null" json:"symbology"` // ean13, upca or code128
+}
@@ -0,0 +1,16 @@
+package models
+
+import "github.com/google/uuid"
+
+// CostLayer is a batch of a variant's stock received at one unit cost.
+// Outgoing stock consumes the oldest layers first, which values sales under FIFO costing.
+type CostLayer struct {
+	BaseModel
+	OrganizationID    uuid.UUID  `gorm:"not null;index" json:"organization_id"`
+	VariantID         uuid.UUID  `gorm:"not null;index" json:"variant_id"`
+	QuantityReceived  float64    `gorm:"type:numeric(14,3);not null" json:"quantity_received"`
+	QuantityRemaining float64    `gorm:"type:numeric(14,3);not null" json:"quantity_remaining"`
+	UnitCost          float64    `gorm:"not null" json:"unit_cost"`
+	SourceType        string     `gorm:"not null" json:"source_type"`
+	SourceID          *uuid.UUID `json:"source_id,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "github.com/google/uuid"
+
+// Location is a shop, branch or warehouse holding stock for an organization
+type Location struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"not null;index" json:"organization_id"`
+	Name           string    `gorm:"not null" json:"name"`
+	Address        string    `json:"address"`
+	IsDefault      bool      `gorm:"not null;default:false" json:"is_default"`
+}
+
+// StockLevel is the balance of a variant held at one location.
+// Variant.Quantity stays the total across all locations.
+type StockLevel struct {
+	BaseModel
+	VariantID  uuid.UUID `gorm:"not null;uniqueIndex:idx_stock_levels_variant_location" json:"variant_id"`
+	LocationID uuid.UUID `gorm:"not null;index;uniqueIndex:idx_stock_levels_variant_location" json:"location_id"`
+	Quantity   float64   `gorm:"type:numeric(14,3);not null;default:0" json:"quantity"`
+	Location   *Location `gorm:"foreignKey:LocationID" json:"location,omitempty"`
+}
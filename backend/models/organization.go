@@ -2,11 +2,26 @@ package models
 
 import "github.com/google/uuid"
 
+// Policies applied when a synced offline sale exceeds the stock on hand
+const (
+	OversellPolicyReject        = "reject"
+	OversellPolicyAllowNegative = "allow_negative"
+	OversellPolicyFlagConflict  = "flag_conflict"
+)
+
+// Methods used to value stock and the cost of goods sold
+const (
+	CostingMethodWeightedAverage = "weighted_average"
+	CostingMethodFIFO            = "fifo"
+)
+
 type Organization struct {
 	BaseModel
 	Name           string        `gorm:"uniqueIndex;not null" json:"name"`
 	OwnerID        uuid.UUID     `gorm:"not null" json:"owner_id"`
 	SubscriptionID *uuid.UUID    `json:"subscription_id,omitempty"`
+	OversellPolicy string        `gorm:"not null;default:'flag_conflict'" json:"oversell_policy"`
+	CostingMethod  string        `gorm:"not null;default:'weighted_average'" json:"costing_method"`
 	Owner          User          `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
 	Subscription   *Subscription `gorm:"foreignKey:SubscriptionID" json:"subscription,omitempty"`
 	Users          []User        `gorm:"many2many:organization_users;" json:"users,omitempty"`
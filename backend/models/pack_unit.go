@@ -0,0 +1,23 @@
+package models
+
+import "github.com/google/uuid"
+
+// PackUnit is a pack a variant is bought or sold in, such as "carton = 24 pcs".
+// Stock is always held in the variant's base UnitType; packs only convert quantities and costs.
+type PackUnit struct {
+	BaseModel
+	VariantID uuid.UUID `gorm:"not null;uniqueIndex:idx_pack_units_variant_name" json:"variant_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_pack_units_variant_name" json:"name"`
+	Factor    float64   `gorm:"type:numeric(14,3);not null" json:"factor"` // Base units per pack
+	SalePrice *float64  `json:"sale_price,omitempty"`                      // Price per pack, defaults to factor times the unit price
+}
+
+// BaseQuantity converts a number of packs to base units
+func (p *PackUnit) BaseQuantity(packs float64) float64 {
+	return RoundQuantity(packs * p.Factor)
+}
+
+// BaseUnitCost converts a cost per pack to a cost per base unit
+func (p *PackUnit) BaseUnitCost(packCost float64) float64 {
+	return packCost / p.Factor
+}
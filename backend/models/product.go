@@ -1,17 +1,45 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"bstock/utils"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Lifecycle statuses of products and variants
+const (
+	CatalogStatusDraft    = "draft"    // Being set up, not sold yet
+	CatalogStatusActive   = "active"   // Sold at the POS and counted towards the plan's product limit
+	CatalogStatusArchived = "archived" // Retired, hidden from the POS but kept for history and reports
+)
 
 type Product struct {
 	BaseModel
-	OrganizationID uuid.UUID  `gorm:"not null;index" json:"organization_id"`
-	Name           string     `gorm:"not null" json:"name"`
-	Description    string     `json:"description"`
-	Category       string     `json:"category"`
-	ImageURL       string     `json:"image_url"`
-	VendorID       *uuid.UUID `json:"vendor_id,omitempty"`
-	Vendor         *Vendor    `gorm:"foreignKey:VendorID" json:"vendor,omitempty"`
-	Variants       []Variant  `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"variants,omitempty"`
+	OrganizationID uuid.UUID          `gorm:"not null;index;index:idx_products_org_name,priority:1" json:"organization_id"`
+	Name           string             `gorm:"not null;index:idx_products_org_name,priority:2" json:"name"` // Backs the default name-sorted listing
+	Description    string             `json:"description"`
+	Category       string             `json:"category"`
+	Status         string             `gorm:"not null;default:'active';index" json:"status"`
+	ArchivedAt     *time.Time         `json:"archived_at,omitempty"`             // When it was archived; set exactly while status is archived
+	Version        int                `gorm:"not null;default:1" json:"version"` // Bumped on every edit; sent as the ETag
+	ImageURL       string             `json:"image_url"`
+	VendorID       *uuid.UUID         `json:"vendor_id,omitempty"`
+	Vendor         *Vendor            `gorm:"foreignKey:VendorID" json:"vendor,omitempty"`
+	Variants       []Variant          `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"variants,omitempty"`
+	Images         []ProductImage     `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"images,omitempty"`
+	Attributes     []ProductAttribute `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"attributes,omitempty"` // Option sets variants are built from
+	SearchName     string             `gorm:"type:text;not null;default:''" json:"-"`                                       // Normalized name for fuzzy search
+	SearchText     string             `gorm:"type:text;not null;default:''" json:"-"`                                       // Normalized category and description
+}
+
+// BeforeSave keeps the search columns in step with the name, category and description
+func (p *Product) BeforeSave(tx *gorm.DB) error {
+	p.SearchName = utils.SearchText(p.Name)
+	p.SearchText = utils.SearchText(p.Category, p.Description)
+	return nil
 }
 
 type Variant struct {
@@ -19,12 +47,42 @@ type Variant struct {
 	ProductID     uuid.UUID         `gorm:"not null;index" json:"product_id"`
 	Attributes    map[string]string `gorm:"type:jsonb;default:'{}'" json:"attributes"` // e.g., {"Size": "L", "Color": "Red"}
 	SKU           string            `gorm:"not null" json:"sku"`
+	PLU           string            `gorm:"index" json:"plu,omitempty"` // Price look-up code used by scale barcodes
 	PurchasePrice float64           `gorm:"not null;default:0" json:"purchase_price"`
 	SalePrice     float64           `gorm:"not null" json:"sale_price"`
-	Quantity      int               `gorm:"not null;default:0" json:"quantity"`
-	MinStockLevel int               `gorm:"default:0" json:"min_stock_level"`
-	UnitType      string            `gorm:"default:'pcs'" json:"unit_type"` // pcs, kg, L, etc.
+	Quantity      float64           `gorm:"type:numeric(14,3);not null;default:0" json:"quantity"`
+	MinStockLevel float64           `gorm:"type:numeric(14,3);default:0" json:"min_stock_level"`
+	UnitType      string            `gorm:"default:'pcs'" json:"unit_type"`     // pcs, kg, L, etc.
+	Position      int               `gorm:"not null;default:0" json:"position"` // Display order within the product
+	Status        string            `gorm:"not null;default:'active'" json:"status"`
+	ArchivedAt    *time.Time        `gorm:"index" json:"archived_at,omitempty"` // When it was archived; set exactly while status is archived
+	Version       int               `gorm:"not null;default:1" json:"version"`  // Bumped on every edit except stock changes; sent as the ETag
 	Product       Product           `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	StockLevels   []StockLevel      `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"stock_levels,omitempty"`
+	Barcodes      []Barcode         `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"barcodes,omitempty"`
+	Packs         []PackUnit        `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"packs,omitempty"`
+	SearchText    string            `gorm:"type:text;not null;default:''" json:"-"` // Normalized SKU and attribute values for fuzzy search
+}
+
+// BeforeSave keeps the search column in step with the SKU and attributes
+func (v *Variant) BeforeSave(tx *gorm.DB) error {
+	v.RefreshSearchText()
+	return nil
+}
+
+// RefreshSearchText recomputes SearchText, for updates that only write selected columns
+func (v *Variant) RefreshSearchText() {
+	names := make([]string, 0, len(v.Attributes))
+	for name := range v.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := []string{v.SKU}
+	for _, name := range names {
+		fields = append(fields, v.Attributes[name])
+	}
+	v.SearchText = utils.SearchText(fields...)
 }
 
 type Vendor struct {
@@ -0,0 +1,13 @@
+package models
+
+import "github.com/google/uuid"
+
+// ProductAttribute defines a dimension a product's variants vary in, e.g. Size with options S, M and L.
+// Once a product has attributes, each variant that isn't archived carries exactly one option of every attribute.
+type ProductAttribute struct {
+	BaseModel
+	ProductID uuid.UUID `gorm:"not null;uniqueIndex:idx_product_attributes_name" json:"product_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_product_attributes_name" json:"name"`
+	Options   []string  `gorm:"type:jsonb;serializer:json;not null" json:"options"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "github.com/google/uuid"
+
+// ProductImage is a photo of a product, optionally specific to one variant, with a thumbnail for the POS grid
+type ProductImage struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"not null;index" json:"organization_id"`
+	ProductID      uuid.UUID  `gorm:"not null;index" json:"product_id"`
+	VariantID      *uuid.UUID `gorm:"index" json:"variant_id,omitempty"`
+	StorageKey     string     `gorm:"not null" json:"-"`
+	ThumbnailKey   string     `gorm:"not null" json:"-"`
+	ContentType    string     `gorm:"not null" json:"content_type"`
+	Size           int64      `gorm:"not null" json:"size"`
+	Width          int        `gorm:"not null" json:"width"`
+	Height         int        `gorm:"not null" json:"height"`
+	Position       int        `gorm:"not null;default:0" json:"position"`
+	Variant        *Variant   `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"-"`
+	URL            string     `gorm:"-" json:"url"`           // Signed download link, filled by the handlers
+	ThumbnailURL   string     `gorm:"-" json:"thumbnail_url"` // Signed thumbnail link, filled by the handlers
+}
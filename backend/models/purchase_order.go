@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusOrdered           = "ordered"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusReceived          = "received"
+	PurchaseOrderStatusCancelled         = "cancelled"
+)
+
+// PurchaseOrder is an order for goods placed with a vendor
+type PurchaseOrder struct {
+	BaseModel
+	OrganizationID uuid.UUID           `gorm:"not null;index" json:"organization_id"`
+	VendorID       uuid.UUID           `gorm:"not null;index" json:"vendor_id"`
+	LocationID     uuid.UUID           `gorm:"not null" json:"location_id"` // Where the goods are delivered
+	Reference      string              `json:"reference"`
+	Status         string              `gorm:"not null;default:'draft';check:status IN ('draft', 'ordered', 'partially_received', 'received', 'cancelled')" json:"status"`
+	ExpectedAt     *time.Time          `json:"expected_at,omitempty"`
+	Note           string              `json:"note"`
+	TotalCost      float64             `gorm:"not null;default:0" json:"total_cost"` // Expected cost of all lines
+	CreatedBy      uuid.UUID           `gorm:"not null" json:"created_by"`
+	Vendor         *Vendor             `gorm:"foreignKey:VendorID" json:"vendor,omitempty"`
+	Location       *Location           `gorm:"foreignKey:LocationID" json:"location,omitempty"`
+	Lines          []PurchaseOrderLine `gorm:"foreignKey:PurchaseOrderID;constraint:OnDelete:CASCADE" json:"lines,omitempty"`
+	Receipts       []GoodsReceipt      `gorm:"foreignKey:PurchaseOrderID" json:"receipts,omitempty"`
+}
+
+type PurchaseOrderLine struct {
+	BaseModel
+	PurchaseOrderID  uuid.UUID `gorm:"not null;index" json:"purchase_order_id"`
+	VariantID        uuid.UUID `gorm:"not null" json:"variant_id"`
+	Quantity         float64   `gorm:"type:numeric(14,3);not null" json:"quantity"`
+	UnitCost         float64   `gorm:"not null" json:"unit_cost"` // Expected cost per unit
+	QuantityReceived float64   `gorm:"type:numeric(14,3);not null;default:0" json:"quantity_received"`
+	Variant          Variant   `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
+
+// GoodsReceipt records a delivery against a purchase order. Deliveries may be partial.
+type GoodsReceipt struct {
+	BaseModel
+	OrganizationID  uuid.UUID          `gorm:"not null;index" json:"organization_id"`
+	PurchaseOrderID uuid.UUID          `gorm:"not null;index" json:"purchase_order_id"`
+	LocationID      uuid.UUID          `gorm:"not null" json:"location_id"`
+	ReceivedBy      uuid.UUID          `gorm:"not null" json:"received_by"`
+	TotalCost       float64            `gorm:"not null;default:0" json:"total_cost"`
+	Note            string             `json:"note"`
+	Items           []GoodsReceiptItem `gorm:"foreignKey:GoodsReceiptID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+}
+
+type GoodsReceiptItem struct {
+	BaseModel
+	GoodsReceiptID      uuid.UUID `gorm:"not null;index" json:"goods_receipt_id"`
+	PurchaseOrderLineID uuid.UUID `gorm:"not null;index" json:"purchase_order_line_id"`
+	VariantID           uuid.UUID `gorm:"not null" json:"variant_id"`
+	Quantity            float64   `gorm:"type:numeric(14,3);not null" json:"quantity"`
+	UnitCost            float64   `gorm:"not null" json:"unit_cost"` // Actual cost per unit on delivery
+}
@@ -1,25 +1,36 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Sale struct {
 	BaseModel
-	OrganizationID  uuid.UUID  `gorm:"not null;index" json:"organization_id"`
-	UserID          uuid.UUID  `gorm:"not null" json:"user_id"`
-	TotalAmount     float64    `gorm:"not null" json:"total_amount"`
-	TotalProfit     float64    `gorm:"not null" json:"total_profit"`
-	PaymentMethod   string     `gorm:"not null" json:"payment_method"`
-	PaymentProofURL string     `json:"payment_proof_url"`
-	IsSynced        bool       `gorm:"not null;default:true" json:"is_synced"`
-	User            User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Items           []SaleItem `gorm:"foreignKey:SaleID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	OrganizationID  uuid.UUID       `gorm:"not null;index;uniqueIndex:idx_sales_org_client_sale" json:"organization_id"`
+	UserID          uuid.UUID       `gorm:"not null" json:"user_id"`
+	LocationID      *uuid.UUID      `gorm:"index" json:"location_id,omitempty"`
+	TotalAmount     float64         `gorm:"not null" json:"total_amount"`
+	TotalProfit     float64         `gorm:"not null" json:"total_profit"`
+	PaymentMethod   string          `gorm:"not null" json:"payment_method"`
+	PaymentProofKey string          `json:"-"`                                                                     // Storage key of the uploaded proof
+	PaymentProofURL string          `gorm:"-" json:"payment_proof_url"`                                            // Signed download link, filled by the handlers
+	ClientSaleID    *uuid.UUID      `gorm:"uniqueIndex:idx_sales_org_client_sale" json:"client_sale_id,omitempty"` // Device-generated ID for offline sales
+	IsSynced        bool            `gorm:"not null;default:false" json:"is_synced"`                               // True for offline sales uploaded through POST /sales/sync
+	SyncedAt        *time.Time      `json:"synced_at,omitempty"`                                                   // When an offline sale was replayed by the device
+	User            User            `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Location        *Location       `gorm:"foreignKey:LocationID" json:"location,omitempty"`
+	Items           []SaleItem      `gorm:"foreignKey:SaleID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Conflicts       []StockConflict `gorm:"foreignKey:SaleID" json:"conflicts,omitempty"`
+	Returns         []SaleReturn    `gorm:"foreignKey:SaleID" json:"returns,omitempty"`
 }
 
 type SaleItem struct {
 	BaseModel
 	SaleID              uuid.UUID `gorm:"not null;index" json:"sale_id"`
 	VariantID           uuid.UUID `gorm:"not null" json:"variant_id"`
-	Quantity            int       `gorm:"not null" json:"quantity"`
+	Quantity            float64   `gorm:"type:numeric(14,3);not null" json:"quantity"`
 	PriceAtSale         float64   `gorm:"not null" json:"price_at_sale"`
 	PurchasePriceAtSale float64   `gorm:"not null" json:"purchase_price_at_sale"`
 	Variant             Variant   `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
@@ -0,0 +1,29 @@
+package models
+
+import "github.com/google/uuid"
+
+// SaleReturn records goods handed back against a sale and the money refunded for them
+type SaleReturn struct {
+	BaseModel
+	OrganizationID uuid.UUID        `gorm:"not null;index" json:"organization_id"`
+	SaleID         uuid.UUID        `gorm:"not null;index" json:"sale_id"`
+	UserID         uuid.UUID        `gorm:"not null" json:"user_id"`
+	RefundAmount   float64          `gorm:"not null" json:"refund_amount"`
+	RefundMethod   string           `gorm:"not null" json:"refund_method"`
+	ProfitReversed float64          `gorm:"not null" json:"profit_reversed"` // Profit given back, including written-off cost
+	Reason         string           `json:"reason"`
+	User           User             `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Items          []SaleReturnItem `gorm:"foreignKey:SaleReturnID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+}
+
+type SaleReturnItem struct {
+	BaseModel
+	SaleReturnID uuid.UUID `gorm:"not null;index" json:"sale_return_id"`
+	SaleItemID   uuid.UUID `gorm:"not null;index" json:"sale_item_id"`
+	VariantID    uuid.UUID `gorm:"not null" json:"variant_id"`
+	Quantity     float64   `gorm:"type:numeric(14,3);not null" json:"quantity"`
+	Damaged      bool      `gorm:"not null;default:false" json:"damaged"` // Written off instead of restocked
+	RefundAmount float64   `gorm:"not null" json:"refund_amount"`
+	CostAmount   float64   `gorm:"not null" json:"cost_amount"`
+	Variant      Variant   `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
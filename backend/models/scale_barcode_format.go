@@ -0,0 +1,20 @@
+package models
+
+import "github.com/google/uuid"
+
+// What the value embedded in a scale barcode represents
+const (
+	ScaleValueWeight = "weight" // Weight in kg
+	ScaleValuePrice  = "price"  // Line amount
+)
+
+// ScaleBarcodeFormat describes how the organization's scales lay out in-store EAN-13 codes for one prefix (20-29).
+// The digits after the prefix hold PLULength digits of PLU, then the value, then the check digit.
+type ScaleBarcodeFormat struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"not null;uniqueIndex:idx_scale_formats_org_prefix" json:"organization_id"`
+	Prefix         string    `gorm:"not null;uniqueIndex:idx_scale_formats_org_prefix" json:"prefix"`
+	PLULength      int       `gorm:"not null;default:5" json:"plu_length"`
+	ValueType      string    `gorm:"not null;check:value_type IN ('weight', 'price')" json:"value_type"`
+	ValueDecimals  int       `gorm:"not null" json:"value_decimals"` // 3 for grams, 2 for cents
+}
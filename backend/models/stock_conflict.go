@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ConflictStatusOpen     = "open"
+	ConflictStatusResolved = "resolved"
+)
+
+// Ways an owner can close a stock conflict
+const (
+	ConflictResolutionAccept  = "accept"  // Keep the resulting balance as is
+	ConflictResolutionRecount = "recount" // Replace the balance with a physical count
+)
+
+// StockConflict flags a synced offline sale that sold more units than were on hand
+type StockConflict struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"not null;index" json:"organization_id"`
+	SaleID         uuid.UUID  `gorm:"not null;index" json:"sale_id"`
+	VariantID      uuid.UUID  `gorm:"not null;index" json:"variant_id"`
+	LocationID     *uuid.UUID `json:"location_id,omitempty"`
+	Requested      float64    `gorm:"type:numeric(14,3);not null" json:"requested"`
+	Available      float64    `gorm:"type:numeric(14,3);not null" json:"available"`
+	Shortfall      float64    `gorm:"type:numeric(14,3);not null" json:"shortfall"`
+	Status         string     `gorm:"not null;default:'open';check:status IN ('open', 'resolved')" json:"status"`
+	Resolution     string     `json:"resolution,omitempty"`
+	ResolutionNote string     `json:"resolution_note,omitempty"`
+	ResolvedBy     *uuid.UUID `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	Variant        Variant    `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
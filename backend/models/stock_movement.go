@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reason codes explaining why a variant's quantity changed
+const (
+	MovementReasonSale        = "sale"
+	MovementReasonReturn      = "return"
+	MovementReasonInitial     = "initial"
+	MovementReasonRestock     = "restock"
+	MovementReasonDamage      = "damage"
+	MovementReasonTheft       = "theft"
+	MovementReasonCorrection  = "correction"
+	MovementReasonTransferOut = "transfer_out"
+	MovementReasonTransferIn  = "transfer_in"
+)
+
+// Source documents a stock movement can originate from
+const (
+	MovementSourceSale       = "sale"
+	MovementSourceAdjustment = "adjustment"
+	MovementSourceReceipt    = "receipt"
+	MovementSourceReturn     = "return"
+	MovementSourceTransfer   = "transfer"
+	MovementSourceStocktake  = "stocktake"
+)
+
+var ErrStockMovementImmutable = errors.New("stock movements are append-only")
+
+// StockMovement is an append-only ledger entry recorded for every change to Variant.Quantity
+type StockMovement struct {
+	BaseModel
+	OrganizationID       uuid.UUID  `gorm:"not null;index" json:"organization_id"`
+	VariantID            uuid.UUID  `gorm:"not null;index" json:"variant_id"`
+	LocationID           *uuid.UUID `gorm:"index" json:"location_id,omitempty"`
+	UserID               uuid.UUID  `gorm:"not null" json:"user_id"`
+	Delta                float64    `gorm:"type:numeric(14,3);not null" json:"delta"`
+	BalanceAfter         float64    `gorm:"type:numeric(14,3);not null" json:"balance_after"`                    // Variant total across locations
+	LocationBalanceAfter float64    `gorm:"type:numeric(14,3);not null;default:0" json:"location_balance_after"` // Balance at LocationID
+	UnitCost             float64    `gorm:"not null;default:0" json:"unit_cost"`                                 // Cost per unit moved
+	ReasonCode           string     `gorm:"not null" json:"reason_code"`
+	SourceType           string     `gorm:"not null" json:"source_type"`
+	SourceID             *uuid.UUID `gorm:"index" json:"source_id,omitempty"`
+	Note                 string     `json:"note"`
+	User                 User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (m *StockMovement) BeforeUpdate(tx *gorm.DB) error {
+	return ErrStockMovementImmutable
+}
+
+func (m *StockMovement) BeforeDelete(tx *gorm.DB) error {
+	return ErrStockMovementImmutable
+}
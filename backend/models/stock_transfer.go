@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TransferStatusDraft      = "draft"
+	TransferStatusDispatched = "dispatched"
+	TransferStatusReceived   = "received"
+	TransferStatusCancelled  = "cancelled"
+)
+
+// StockTransfer moves goods between two locations of the same organization
+type StockTransfer struct {
+	BaseModel
+	OrganizationID        uuid.UUID           `gorm:"not null;index" json:"organization_id"`
+	SourceLocationID      uuid.UUID           `gorm:"not null;index" json:"source_location_id"`
+	DestinationLocationID uuid.UUID           `gorm:"not null;index" json:"destination_location_id"`
+	Status                string              `gorm:"not null;default:'draft';check:status IN ('draft', 'dispatched', 'received', 'cancelled')" json:"status"`
+	Note                  string              `json:"note"`
+	CreatedBy             uuid.UUID           `gorm:"not null" json:"created_by"`
+	DispatchedBy          *uuid.UUID          `json:"dispatched_by,omitempty"`
+	DispatchedAt          *time.Time          `json:"dispatched_at,omitempty"`
+	ReceivedBy            *uuid.UUID          `json:"received_by,omitempty"`
+	ReceivedAt            *time.Time          `json:"received_at,omitempty"`
+	SourceLocation        *Location           `gorm:"foreignKey:SourceLocationID" json:"source_location,omitempty"`
+	DestinationLocation   *Location           `gorm:"foreignKey:DestinationLocationID" json:"destination_location,omitempty"`
+	Items                 []StockTransferItem `gorm:"foreignKey:TransferID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+}
+
+type StockTransferItem struct {
+	BaseModel
+	TransferID       uuid.UUID `gorm:"not null;index" json:"transfer_id"`
+	VariantID        uuid.UUID `gorm:"not null" json:"variant_id"`
+	Quantity         float64   `gorm:"type:numeric(14,3);not null" json:"quantity"`              // Quantity sent
+	QuantityReceived *float64  `gorm:"type:numeric(14,3)" json:"quantity_received,omitempty"`    // Set on receipt
+	Discrepancy      float64   `gorm:"type:numeric(14,3);not null;default:0" json:"discrepancy"` // Sent minus received
+	Variant          Variant   `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StocktakeStatusOpen      = "open"
+	StocktakeStatusCommitted = "committed"
+	StocktakeStatusCancelled = "cancelled"
+)
+
+// Stocktake is a physical count session at one location, optionally limited to a product category.
+// Counts can be submitted from several devices while it is open; committing posts the variances as adjustments.
+type Stocktake struct {
+	BaseModel
+	OrganizationID uuid.UUID       `gorm:"not null;index" json:"organization_id"`
+	LocationID     uuid.UUID       `gorm:"not null;index" json:"location_id"`
+	Category       string          `json:"category"` // Empty counts the whole location
+	Status         string          `gorm:"not null;default:'open';check:status IN ('open', 'committed', 'cancelled')" json:"status"`
+	Note           string          `json:"note"`
+	OpenedBy       uuid.UUID       `gorm:"not null" json:"opened_by"`
+	CommittedBy    *uuid.UUID      `json:"committed_by,omitempty"`
+	CommittedAt    *time.Time      `json:"committed_at,omitempty"`
+	Location       *Location       `gorm:"foreignKey:LocationID" json:"location,omitempty"`
+	Items          []StocktakeItem `gorm:"foreignKey:StocktakeID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+}
+
+// StocktakeItem is one variant in scope of a stocktake. The system quantity and variance are fixed on commit.
+type StocktakeItem struct {
+	BaseModel
+	StocktakeID     uuid.UUID  `gorm:"not null;uniqueIndex:idx_stocktake_items_variant" json:"stocktake_id"`
+	VariantID       uuid.UUID  `gorm:"not null;uniqueIndex:idx_stocktake_items_variant" json:"variant_id"`
+	CountedQuantity *float64   `gorm:"type:numeric(14,3)" json:"counted_quantity,omitempty"` // Nil until counted
+	CountedBy       *uuid.UUID `json:"counted_by,omitempty"`
+	CountedAt       *time.Time `json:"counted_at,omitempty"`
+	SystemQuantity  *float64   `gorm:"type:numeric(14,3)" json:"system_quantity,omitempty"`   // Location balance when committed
+	Variance        float64    `gorm:"type:numeric(14,3);not null;default:0" json:"variance"` // Counted minus system
+	UnitCost        float64    `gorm:"not null;default:0" json:"unit_cost"`
+	VarianceValue   float64    `gorm:"not null;default:0" json:"variance_value"` // Variance at cost
+	Variant         Variant    `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+}
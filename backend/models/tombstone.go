@@ -0,0 +1,20 @@
+package models
+
+import "github.com/google/uuid"
+
+// Kinds of records offline devices are told about when they are deleted
+const (
+	TombstoneProduct    = "product"
+	TombstoneVariant    = "variant"
+	TombstoneStockLevel = "stock_level"
+	TombstoneVendor     = "vendor"
+)
+
+// Tombstone remembers a hard-deleted catalog record so catalog sync can tell devices to drop it.
+// CreatedAt is when the record was deleted.
+type Tombstone struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"not null;index" json:"organization_id"`
+	EntityType     string    `gorm:"not null" json:"entity_type"`
+	EntityID       uuid.UUID `gorm:"not null" json:"entity_id"`
+}
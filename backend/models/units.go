@@ -0,0 +1,59 @@
+package models
+
+import (
+	"math"
+	"strings"
+)
+
+// QuantityScale is the number of decimals quantities are stored with
+const QuantityScale = 3
+
+// unitPrecision is how many decimals a quantity in each unit may carry.
+// Units not listed are counted in whole numbers.
+var unitPrecision = map[string]int{
+	"pcs": 0,
+	"kg":  3,
+	"g":   0,
+	"l":   3,
+	"ml":  0,
+	"m":   3,
+	"cm":  0,
+}
+
+// QuantityPrecision returns the number of decimals allowed for quantities in unitType
+func QuantityPrecision(unitType string) int {
+	return unitPrecision[strings.ToLower(unitType)]
+}
+
+// UnitPrecisions returns the decimals allowed for each known unit
+func UnitPrecisions() map[string]int {
+	precisions := make(map[string]int, len(unitPrecision))
+	for unit, precision := range unitPrecision {
+		precisions[unit] = precision
+	}
+	return precisions
+}
+
+// KnownUnit reports whether unitType is one of the units listed by UnitPrecisions
+func KnownUnit(unitType string) bool {
+	_, ok := unitPrecision[strings.ToLower(unitType)]
+	return ok
+}
+
+// ValidQuantity reports whether quantity has no more decimals than unitType allows
+func ValidQuantity(quantity float64, unitType string) bool {
+	scale := math.Pow10(QuantityPrecision(unitType))
+	return math.Abs(quantity*scale-math.Round(quantity*scale)) < 1e-6
+}
+
+// RoundToUnit rounds quantity to the decimals unitType allows
+func RoundToUnit(quantity float64, unitType string) float64 {
+	scale := math.Pow10(QuantityPrecision(unitType))
+	return math.Round(quantity*scale) / scale
+}
+
+// RoundQuantity rounds to the stored precision, dropping floating point noise from arithmetic
+func RoundQuantity(quantity float64) float64 {
+	scale := math.Pow10(QuantityScale)
+	return math.Round(quantity*scale) / scale
+}
@@ -17,6 +17,7 @@ type OrganizationUser struct {
 	UserID         uuid.UUID    `gorm:"not null" json:"user_id"`
 	OrganizationID uuid.UUID    `gorm:"not null" json:"organization_id"`
 	Role           string       `gorm:"not null;check:role IN ('owner', 'cashier')" json:"role"`
+	LocationID     *uuid.UUID   `json:"location_id,omitempty"` // Location a cashier is assigned to
 	User           User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Organization   Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 }
@@ -19,6 +19,12 @@ func SetupRoutes(r *gin.Engine) {
 		// Webhooks (public, but validated in handler)
 		api.POST("/webhooks/payment", handlers.HandlePaymentWebhook)
 
+		// Stored files (public, authorized by a signed URL)
+		api.GET("/files/*key", handlers.ServeFile)
+
+		// Live stock and catalog changes for terminals, authenticated by header or ?token=
+		api.GET("/events", middleware.TokenFromQuery(), middleware.AuthRequired(), handlers.StreamEvents)
+
 		// Protected routes
 		protected := api.Group("")
 		protected.Use(middleware.AuthRequired())
@@ -34,31 +40,109 @@ func SetupRoutes(r *gin.Engine) {
 				subscriptions.POST("/dev/set-plan/:plan_name", handlers.DevSetPlan)
 			}
 
+			// Organization settings
+			organization := protected.Group("/organization")
+			{
+				organization.GET("/settings", handlers.GetOrganizationSettings)
+				organization.PUT("/settings", middleware.RequireRole("owner"), handlers.UpdateOrganizationSettings)
+				organization.GET("/scale-barcodes", handlers.ListScaleBarcodeFormats)
+				organization.PUT("/scale-barcodes", middleware.RequireRole("owner"), handlers.UpdateScaleBarcodeFormats)
+			}
+
 			// User management (Owner only)
 			users := protected.Group("/users")
 			users.Use(middleware.RequireRole("owner"))
 			{
 				users.GET("", handlers.ListUsers)
 				users.POST("/invite", middleware.CheckUserLimit, handlers.InviteUser)
+				users.PUT("/:id/location", handlers.UpdateUserLocation)
 				users.DELETE("/:id", handlers.RemoveUser)
 			}
 
+			// Locations
+			locations := protected.Group("/locations")
+			{
+				locations.GET("", handlers.ListLocations)
+				locations.POST("", middleware.RequireRole("owner"), middleware.CheckLocationLimit, handlers.CreateLocation)
+				locations.PUT("/:id", middleware.RequireRole("owner"), handlers.UpdateLocation)
+				locations.DELETE("/:id", middleware.RequireRole("owner"), handlers.DeleteLocation)
+				locations.GET("/:id/stock", handlers.GetLocationStock)
+			}
+
+			// Stock transfers between locations
+			transfers := protected.Group("/transfers")
+			{
+				transfers.GET("", handlers.ListTransfers)
+				transfers.POST("", handlers.CreateTransfer)
+				transfers.GET("/:id", handlers.GetTransfer)
+				transfers.POST("/:id/dispatch", handlers.DispatchTransfer)
+				transfers.POST("/:id/receive", handlers.ReceiveTransfer)
+				transfers.POST("/:id/cancel", handlers.CancelTransfer)
+			}
+
 			// Products
 			products := protected.Group("/products")
 			{
 				products.GET("", handlers.ListProducts)
-				products.POST("", middleware.CheckProductLimit, handlers.CreateProduct)
+				products.POST("", handlers.CreateProduct)
+				products.POST("/import", middleware.RequireRole("owner"), handlers.ImportProducts)
+				products.GET("/export", middleware.RequireRole("owner"), handlers.ExportProducts)
+				products.GET("/search", handlers.SearchProducts)
 				products.GET("/:id", handlers.GetProduct)
 				products.PUT("/:id", handlers.UpdateProduct)
 				products.DELETE("/:id", middleware.RequireRole("owner"), handlers.DeleteProduct)
+				products.POST("/:id/archive", middleware.RequireRole("owner"), handlers.ArchiveProduct)
+				products.POST("/:id/unarchive", middleware.RequireRole("owner"), middleware.CheckProductLimit, handlers.UnarchiveProduct)
+				products.POST("/:id/variants", handlers.CreateVariant)
+				products.PUT("/:id/variants/order", handlers.ReorderVariants)
+				products.POST("/:id/variants/matrix", handlers.GenerateVariantMatrix)
+				products.GET("/:id/attributes", handlers.GetProductAttributes)
+				products.PUT("/:id/attributes", handlers.SetProductAttributes)
+				products.GET("/:id/images", handlers.ListProductImages)
+				products.POST("/:id/images", handlers.UploadProductImage)
+				products.DELETE("/:id/images/:image_id", handlers.DeleteProductImage)
 			}
 
 			// Variants
 			variants := protected.Group("/variants")
 			{
 				variants.PUT("/:id", handlers.UpdateVariant)
+				variants.DELETE("/:id", middleware.RequireRole("owner"), handlers.DeleteVariant)
+				variants.POST("/:id/archive", middleware.RequireRole("owner"), handlers.ArchiveVariant)
+				variants.POST("/:id/restore", middleware.RequireRole("owner"), handlers.RestoreVariant)
 				variants.POST("/:id/adjust-stock", handlers.AdjustStock)
+				variants.POST("/:id/images", handlers.UploadVariantImage)
+				variants.GET("/:id/movements", handlers.GetVariantMovements)
 				variants.GET("/low-stock", handlers.GetLowStockAlerts)
+				variants.GET("/units", handlers.ListUnits)
+				variants.GET("/by-barcode/:code", handlers.GetVariantByBarcode)
+			}
+
+			// Stock conflicts from synced offline sales (Owner only)
+			stockConflicts := protected.Group("/stock-conflicts")
+			stockConflicts.Use(middleware.RequireRole("owner"))
+			{
+				stockConflicts.GET("", handlers.ListStockConflicts)
+				stockConflicts.POST("/:id/resolve", handlers.ResolveStockConflict)
+			}
+
+			// Inventory reports (Owner only)
+			inventory := protected.Group("/inventory")
+			inventory.Use(middleware.RequireRole("owner"))
+			{
+				inventory.GET("/valuation", handlers.GetInventoryValuation)
+			}
+
+			// Stocktakes
+			stocktakes := protected.Group("/stocktakes")
+			{
+				stocktakes.GET("", handlers.ListStocktakes)
+				stocktakes.POST("", middleware.RequireRole("owner"), handlers.OpenStocktake)
+				stocktakes.GET("/:id", handlers.GetStocktake)
+				stocktakes.POST("/:id/counts", handlers.RecordStocktakeCounts)
+				stocktakes.GET("/:id/variance", handlers.GetStocktakeVariance)
+				stocktakes.POST("/:id/commit", middleware.RequireRole("owner"), handlers.CommitStocktake)
+				stocktakes.POST("/:id/cancel", middleware.RequireRole("owner"), handlers.CancelStocktake)
 			}
 
 			// Vendors
@@ -67,15 +151,36 @@ func SetupRoutes(r *gin.Engine) {
 				vendors.GET("", handlers.ListVendors)
 				vendors.POST("", handlers.CreateVendor)
 				vendors.DELETE("/:id", handlers.DeleteVendor)
+				vendors.GET("/:id/purchase-orders", handlers.ListVendorPurchaseOrders)
+			}
+
+			// Purchase orders and goods receiving
+			purchaseOrders := protected.Group("/purchase-orders")
+			{
+				purchaseOrders.GET("", handlers.ListPurchaseOrders)
+				purchaseOrders.POST("", middleware.RequireRole("owner"), handlers.CreatePurchaseOrder)
+				purchaseOrders.GET("/:id", handlers.GetPurchaseOrder)
+				purchaseOrders.POST("/:id/submit", middleware.RequireRole("owner"), handlers.SubmitPurchaseOrder)
+				purchaseOrders.POST("/:id/cancel", middleware.RequireRole("owner"), handlers.CancelPurchaseOrder)
+				purchaseOrders.POST("/:id/receipts", handlers.ReceivePurchaseOrder)
 			}
 
 			// Sales
 			sales := protected.Group("/sales")
 			{
 				sales.POST("", handlers.ProcessSale)
+				sales.POST("/sync", handlers.SyncSales)
 				sales.GET("", handlers.ListSales)
 				sales.GET("/:id", handlers.GetSale)
 				sales.POST("/:id/upload-proof", handlers.UploadPaymentProof)
+				sales.POST("/:id/returns", handlers.CreateSaleReturn)
+				sales.GET("/:id/returns", handlers.ListSaleReturns)
+			}
+
+			// Offline sync
+			sync := protected.Group("/sync")
+			{
+				sync.GET("/catalog", handlers.SyncCatalog)
 			}
 
 			// Receipts
@@ -3,8 +3,8 @@ package services
 import (
 	"bstock/database"
 	"bstock/models"
-	"time"
 	"github.com/google/uuid"
+	"time"
 )
 
 type AnalyticsService struct{}
@@ -14,11 +14,16 @@ func NewAnalyticsService() *AnalyticsService {
 }
 
 type Summary struct {
-	TotalRevenue    float64 `json:"total_revenue"`
-	TotalCost       float64 `json:"total_cost"`
-	GrossProfit     float64 `json:"gross_profit"`
+	TotalRevenue     float64 `json:"total_revenue"`
+	TotalCost        float64 `json:"total_cost"`
+	GrossProfit      float64 `json:"gross_profit"`
 	TransactionCount int64   `json:"transaction_count"`
-	ItemsSold       int64   `json:"items_sold"`
+	ItemsSold        float64 `json:"items_sold"`
+	ReturnCount      int64   `json:"return_count"`
+	ItemsReturned    float64 `json:"items_returned"`
+	TotalRefunds     float64 `json:"total_refunds"`
+	NetRevenue       float64 `json:"net_revenue"` // Revenue less refunds issued in the period
+	NetProfit        float64 `json:"net_profit"`  // Gross profit less profit reversed by returns
 }
 
 // GetSummary returns aggregated metrics for a date range
@@ -50,28 +55,58 @@ func (s *AnalyticsService) GetSummary(orgID uuid.UUID, startDate, endDate time.T
 
 	// Count items sold
 	var itemsResult struct {
-		TotalItems int64
+		TotalItems float64
 	}
 	database.DB.Model(&models.SaleItem{}).
 		Joins("JOIN sales ON sales.id = sale_items.sale_id").
 		Where("sales.organization_id = ?", orgID).
 		Where("sales.created_at >= ? AND sales.created_at <= ?", startDate, endDate).
-		Select("SUM(sale_items.quantity) as total_items").
+		Select("COALESCE(SUM(sale_items.quantity), 0) as total_items").
 		Scan(&itemsResult)
 
 	summary.ItemsSold = itemsResult.TotalItems
 
+	// Returns are counted in the period they were refunded
+	var returnsResult struct {
+		TotalRefunds   float64
+		ProfitReversed float64
+		Count          int64
+	}
+	if err := database.DB.Model(&models.SaleReturn{}).
+		Where("organization_id = ?", orgID).
+		Where("created_at >= ? AND created_at <= ?", startDate, endDate).
+		Select("COALESCE(SUM(refund_amount), 0) as total_refunds, COALESCE(SUM(profit_reversed), 0) as profit_reversed, COUNT(*) as count").
+		Scan(&returnsResult).Error; err != nil {
+		return nil, err
+	}
+
+	var returnedItemsResult struct {
+		TotalItems float64
+	}
+	database.DB.Model(&models.SaleReturnItem{}).
+		Joins("JOIN sale_returns ON sale_returns.id = sale_return_items.sale_return_id").
+		Where("sale_returns.organization_id = ?", orgID).
+		Where("sale_returns.created_at >= ? AND sale_returns.created_at <= ?", startDate, endDate).
+		Select("COALESCE(SUM(sale_return_items.quantity), 0) as total_items").
+		Scan(&returnedItemsResult)
+
+	summary.ReturnCount = returnsResult.Count
+	summary.ItemsReturned = returnedItemsResult.TotalItems
+	summary.TotalRefunds = returnsResult.TotalRefunds
+	summary.NetRevenue = summary.TotalRevenue - returnsResult.TotalRefunds
+	summary.NetProfit = summary.GrossProfit - returnsResult.ProfitReversed
+
 	return &summary, nil
 }
 
 type ProductPerformance struct {
-	ProductID    uuid.UUID `json:"product_id"`
-	ProductName  string    `json:"product_name"`
-	VariantID    uuid.UUID `json:"variant_id"`
-	SKU          string    `json:"sku"`
-	TotalQuantity int      `json:"total_quantity"`
-	TotalRevenue float64   `json:"total_revenue"`
-	TotalProfit  float64   `json:"total_profit"`
+	ProductID     uuid.UUID `json:"product_id"`
+	ProductName   string    `json:"product_name"`
+	VariantID     uuid.UUID `json:"variant_id"`
+	SKU           string    `json:"sku"`
+	TotalQuantity float64   `json:"total_quantity"`
+	TotalRevenue  float64   `json:"total_revenue"`
+	TotalProfit   float64   `json:"total_profit"`
 }
 
 // GetTopSellingProducts returns products ranked by quantity sold
@@ -131,10 +166,13 @@ func (s *AnalyticsService) GetMostProfitableProducts(orgID uuid.UUID, startDate,
 }
 
 type DailySales struct {
-	Date       string  `json:"date"`
-	Revenue    float64 `json:"revenue"`
-	Profit     float64 `json:"profit"`
-	Transactions int   `json:"transactions"`
+	Date         string  `json:"date"`
+	Revenue      float64 `json:"revenue"`
+	Profit       float64 `json:"profit"`
+	Transactions int     `json:"transactions"`
+	Refunds      float64 `json:"refunds"`
+	NetRevenue   float64 `json:"net_revenue"`
+	NetProfit    float64 `json:"net_profit"`
 }
 
 // GetDailySales returns daily breakdown for charting
@@ -142,18 +180,40 @@ func (s *AnalyticsService) GetDailySales(orgID uuid.UUID, startDate, endDate tim
 	var results []DailySales
 
 	err := database.DB.Raw(`
+		WITH daily_sales AS (
+			SELECT
+				DATE(created_at) as date,
+				SUM(total_amount) as revenue,
+				SUM(total_profit) as profit,
+				COUNT(*) as transactions
+			FROM sales
+			WHERE organization_id = ?
+			  AND created_at >= ?
+			  AND created_at <= ?
+			GROUP BY DATE(created_at)
+		), daily_returns AS (
+			SELECT
+				DATE(created_at) as date,
+				SUM(refund_amount) as refunds,
+				SUM(profit_reversed) as profit_reversed
+			FROM sale_returns
+			WHERE organization_id = ?
+			  AND created_at >= ?
+			  AND created_at <= ?
+			GROUP BY DATE(created_at)
+		)
 		SELECT
-			DATE(created_at) as date,
-			SUM(total_amount) as revenue,
-			SUM(total_profit) as profit,
-			COUNT(*) as transactions
-		FROM sales
-		WHERE organization_id = ?
-		  AND created_at >= ?
-		  AND created_at <= ?
-		GROUP BY DATE(created_at)
+			COALESCE(daily_sales.date, daily_returns.date) as date,
+			COALESCE(daily_sales.revenue, 0) as revenue,
+			COALESCE(daily_sales.profit, 0) as profit,
+			COALESCE(daily_sales.transactions, 0) as transactions,
+			COALESCE(daily_returns.refunds, 0) as refunds,
+			COALESCE(daily_sales.revenue, 0) - COALESCE(daily_returns.refunds, 0) as net_revenue,
+			COALESCE(daily_sales.profit, 0) - COALESCE(daily_returns.profit_reversed, 0) as net_profit
+		FROM daily_sales
+		FULL OUTER JOIN daily_returns ON daily_returns.date = daily_sales.date
 		ORDER BY date ASC
-	`, orgID, startDate, endDate).Scan(&results).Error
+	`, orgID, startDate, endDate, orgID, startDate, endDate).Scan(&results).Error
 
 	return results, err
 }
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxMatrixSize caps how many variants one product's attribute options may combine into
+const maxMatrixSize = 500
+
+var (
+	ErrInvalidAttributeDefinition = errors.New("invalid attribute definition")
+	ErrAttributeConflicts         = errors.New("existing variants do not fit the attribute definitions")
+	ErrDuplicateAttributes        = errors.New("another variant already has these attribute values")
+	ErrNoAttributes               = errors.New("product has no attribute definitions")
+	ErrMatrixTooLarge             = fmt.Errorf("attribute options combine into more than %d variants", maxMatrixSize)
+	ErrMatrixPriceRequired        = errors.New("sale_price is required when the product has no variants to copy prices from")
+	ErrInvalidSKUTemplate         = errors.New("sku template references an unknown placeholder")
+	ErrDuplicateSKU               = errors.New("sku already exists")
+)
+
+// AttributeError is returned when variant attributes don't match the product's definitions
+type AttributeError struct {
+	Attribute string
+	Value     string
+	Message   string
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("attribute %s: %s", e.Attribute, e.Message)
+}
+
+// AttributeDefinition is a requested attribute with its options. Default fills the attribute on
+// existing variants that don't have it yet.
+type AttributeDefinition struct {
+	Name    string
+	Options []string
+	Default string
+}
+
+// AttributeConflict is an existing variant that cannot be fitted to new attribute definitions
+type AttributeConflict struct {
+	VariantID uuid.UUID `json:"variant_id"`
+	SKU       string    `json:"sku"`
+	Message   string    `json:"message"`
+}
+
+// MatrixInput describes how to generate the missing variants of a product's attribute matrix
+type MatrixInput struct {
+	OrganizationID uuid.UUID
+	ProductID      uuid.UUID
+	SKUTemplate    string   // e.g. "{product}-{Size}-{Color}", defaults to the product followed by every attribute
+	SalePrice      *float64 // Defaults to the product's first active variant
+	PurchasePrice  *float64
+	MinStockLevel  *float64
+	UnitType       string
+}
+
+// MatrixResult lists what generating a matrix changed
+type MatrixResult struct {
+	Created  []models.Variant `json:"created"`
+	Restored []models.Variant `json:"restored"`
+	Existing int              `json:"existing"`
+}
+
+type AttributeService struct{}
+
+func NewAttributeService() *AttributeService {
+	return &AttributeService{}
+}
+
+// Definitions returns a product's attributes in display order
+func (s *AttributeService) Definitions(tx *gorm.DB, productID uuid.UUID) ([]models.ProductAttribute, error) {
+	var attributes []models.ProductAttribute
+	err := tx.Where("product_id = ?", productID).Order("position ASC").Find(&attributes).Error
+	return attributes, err
+}
+
+// ValidateVariantAttributes checks attributes against the product's definitions and returns them with
+// names and values in their defined spelling. Products without definitions accept any attributes.
+// excludeVariantID is skipped when checking that no other variant that isn't archived has the same values.
+func (s *AttributeService) ValidateVariantAttributes(tx *gorm.DB, productID, excludeVariantID uuid.UUID, attributes map[string]string) (map[string]string, error) {
+	definitions, err := s.Definitions(tx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(definitions) == 0 {
+		return attributes, nil
+	}
+
+	normalized, err := NormalizeAttributes(definitions, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []models.Variant
+	if err := tx.Where("product_id = ? AND id <> ? AND status <> ?", productID, excludeVariantID, models.CatalogStatusArchived).
+		Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	key := combinationKey(definitions, normalized)
+	for _, variant := range variants {
+		if combinationKey(definitions, variant.Attributes) == key {
+			return nil, ErrDuplicateAttributes
+		}
+	}
+
+	return normalized, nil
+}
+
+// NormalizeAttributes requires exactly one defined option for every definition. Names and values match
+// case-insensitively and are returned as defined.
+func NormalizeAttributes(definitions []models.ProductAttribute, attributes map[string]string) (map[string]string, error) {
+	if len(definitions) == 0 {
+		return attributes, nil
+	}
+
+	given := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		given[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	normalized := make(map[string]string, len(definitions))
+	for _, definition := range definitions {
+		key := strings.ToLower(definition.Name)
+		value, ok := given[key]
+		if !ok || value == "" {
+			return nil, &AttributeError{Attribute: definition.Name, Message: "is required"}
+		}
+		delete(given, key)
+
+		option, ok := matchOption(definition.Options, value)
+		if !ok {
+			return nil, &AttributeError{
+				Attribute: definition.Name,
+				Value:     value,
+				Message:   fmt.Sprintf("%q is not one of %s", value, strings.Join(definition.Options, ", ")),
+			}
+		}
+		normalized[definition.Name] = option
+	}
+
+	for name := range given {
+		return nil, &AttributeError{Attribute: name, Message: "is not defined for this product"}
+	}
+
+	return normalized, nil
+}
+
+// SetDefinitions replaces a product's attributes and refits its variants that are not archived: removed attributes are
+// dropped from them and new ones filled with the definition's default. When a variant cannot be fitted
+// nothing is saved and the conflicts are returned with ErrAttributeConflicts.
+func (s *AttributeService) SetDefinitions(tx *gorm.DB, productID uuid.UUID, definitions []AttributeDefinition) ([]models.ProductAttribute, []AttributeConflict, error) {
+	attributes := make([]models.ProductAttribute, 0, len(definitions))
+	names := make(map[string]bool, len(definitions))
+	combinations := 1
+
+	for i, definition := range definitions {
+		name := strings.TrimSpace(definition.Name)
+		if name == "" {
+			return nil, nil, fmt.Errorf("%w: attribute name is required", ErrInvalidAttributeDefinition)
+		}
+		if names[strings.ToLower(name)] {
+			return nil, nil, fmt.Errorf("%w: attribute %s is listed twice", ErrInvalidAttributeDefinition, name)
+		}
+		names[strings.ToLower(name)] = true
+
+		options := make([]string, 0, len(definition.Options))
+		for _, option := range definition.Options {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				continue
+			}
+			if _, duplicate := matchOption(options, option); duplicate {
+				return nil, nil, fmt.Errorf("%w: %s lists option %s twice", ErrInvalidAttributeDefinition, name, option)
+			}
+			options = append(options, option)
+		}
+		if len(options) == 0 {
+			return nil, nil, fmt.Errorf("%w: %s needs at least one option", ErrInvalidAttributeDefinition, name)
+		}
+		if definition.Default != "" {
+			if _, ok := matchOption(options, definition.Default); !ok {
+				return nil, nil, fmt.Errorf("%w: default %s is not an option of %s", ErrInvalidAttributeDefinition, definition.Default, name)
+			}
+		}
+
+		combinations *= len(options)
+		if combinations > maxMatrixSize {
+			return nil, nil, ErrMatrixTooLarge
+		}
+
+		attributes = append(attributes, models.ProductAttribute{
+			ProductID: productID,
+			Name:      name,
+			Options:   options,
+			Position:  i,
+		})
+	}
+
+	var variants []models.Variant
+	if err := tx.Where("product_id = ? AND status <> ?", productID, models.CatalogStatusArchived).
+		Order("position ASC").
+		Find(&variants).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var conflicts []AttributeConflict
+	seen := make(map[string]string)
+	for i := range variants {
+		variant := &variants[i]
+		fitted := make(map[string]string, len(definitions))
+		for name, value := range variant.Attributes {
+			if names[strings.ToLower(name)] {
+				fitted[name] = value
+			}
+		}
+		for _, definition := range definitions {
+			if definition.Default == "" {
+				continue
+			}
+			if _, ok := lookupAttribute(fitted, definition.Name); !ok {
+				fitted[definition.Name] = definition.Default
+			}
+		}
+
+		normalized, err := NormalizeAttributes(attributes, fitted)
+		if err != nil {
+			conflicts = append(conflicts, AttributeConflict{VariantID: variant.ID, SKU: variant.SKU, Message: err.Error()})
+			continue
+		}
+
+		// Without definitions every variant has the same empty combination, which is not a clash
+		if len(attributes) > 0 {
+			key := combinationKey(attributes, normalized)
+			if sku, ok := seen[key]; ok {
+				conflicts = append(conflicts, AttributeConflict{
+					VariantID: variant.ID,
+					SKU:       variant.SKU,
+					Message:   "has the same attribute values as " + sku,
+				})
+				continue
+			}
+			seen[key] = variant.SKU
+		}
+		variant.Attributes = normalized
+	}
+
+	if len(conflicts) > 0 {
+		return nil, conflicts, ErrAttributeConflicts
+	}
+
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductAttribute{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(attributes) > 0 {
+		if err := tx.Create(&attributes).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(attributes) > 0 {
+		for _, variant := range variants {
+			variant.RefreshSearchText()
+			if err := tx.Model(&variant).Updates(map[string]interface{}{
+				"attributes":  variant.Attributes,
+				"search_text": variant.SearchText,
+				"version":     gorm.Expr("version + 1"),
+			}).Error; err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return attributes, nil, nil
+}
+
+// GenerateMatrix creates a variant for every combination of attribute options the product lacks, and
+// restores archived variants whose combination is part of the matrix.
+func (s *AttributeService) GenerateMatrix(tx *gorm.DB, input MatrixInput) (*MatrixResult, error) {
+	var product models.Product
+	if err := tx.Where("id = ? AND organization_id = ?", input.ProductID, input.OrganizationID).
+		First(&product).Error; err != nil {
+		return nil, err
+	}
+
+	definitions, err := s.Definitions(tx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(definitions) == 0 {
+		return nil, ErrNoAttributes
+	}
+
+	var variants []models.Variant
+	if err := tx.Where("product_id = ?", product.ID).
+		Order("status = 'archived', position ASC").
+		Find(&variants).Error; err != nil {
+		return nil, err
+	}
+
+	template := input.SKUTemplate
+	if template == "" {
+		template = "{product}"
+		for _, definition := range definitions {
+			template += "-{" + definition.Name + "}"
+		}
+	}
+
+	var base *models.Variant
+	if len(variants) > 0 && variants[0].Status != models.CatalogStatusArchived {
+		base = &variants[0]
+	}
+	salePrice, purchasePrice, minStockLevel, unitType := input.SalePrice, input.PurchasePrice, input.MinStockLevel, input.UnitType
+	if base != nil {
+		if salePrice == nil {
+			salePrice = &base.SalePrice
+		}
+		if purchasePrice == nil {
+			purchasePrice = &base.PurchasePrice
+		}
+		if minStockLevel == nil {
+			minStockLevel = &base.MinStockLevel
+		}
+		if unitType == "" {
+			unitType = base.UnitType
+		}
+	}
+	if salePrice == nil {
+		return nil, ErrMatrixPriceRequired
+	}
+	if purchasePrice == nil {
+		purchasePrice = new(float64)
+	}
+	if minStockLevel == nil {
+		minStockLevel = new(float64)
+	}
+	if unitType == "" {
+		unitType = "pcs"
+	}
+
+	existing := make(map[string]*models.Variant, len(variants))
+	for i := range variants {
+		normalized, err := NormalizeAttributes(definitions, variants[i].Attributes)
+		if err != nil {
+			continue // Archived variants may predate the current definitions
+		}
+		key := combinationKey(definitions, normalized)
+		if _, ok := existing[key]; !ok {
+			existing[key] = &variants[i]
+		}
+	}
+
+	var skus []string
+	if err := tx.Model(&models.Variant{}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ?", input.OrganizationID).
+		Pluck("LOWER(variants.sku)", &skus).Error; err != nil {
+		return nil, err
+	}
+	takenSKUs := toSet(skus)
+
+	position, err := NewVariantService().NextPosition(tx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MatrixResult{Created: []models.Variant{}, Restored: []models.Variant{}}
+	for _, combination := range attributeCombinations(definitions) {
+		if variant, ok := existing[combinationKey(definitions, combination)]; ok {
+			if variant.Status != models.CatalogStatusArchived {
+				result.Existing++
+				continue
+			}
+			if err := NewVariantService().Restore(tx, variant); err != nil {
+				return nil, err
+			}
+			result.Restored = append(result.Restored, *variant)
+			continue
+		}
+
+		sku, err := renderSKU(template, product.Name, definitions, combination)
+		if err != nil {
+			return nil, err
+		}
+		if takenSKUs[strings.ToLower(sku)] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateSKU, sku)
+		}
+		takenSKUs[strings.ToLower(sku)] = true
+
+		variant := models.Variant{
+			ProductID:     product.ID,
+			Attributes:    combination,
+			SKU:           sku,
+			PurchasePrice: *purchasePrice,
+			SalePrice:     *salePrice,
+			MinStockLevel: *minStockLevel,
+			UnitType:      unitType,
+			Position:      position,
+		}
+		if err := tx.Create(&variant).Error; err != nil {
+			return nil, err
+		}
+		position++
+		result.Created = append(result.Created, variant)
+	}
+
+	return result, nil
+}
+
+// attributeCombinations returns every combination of options, varying the last attribute fastest
+func attributeCombinations(definitions []models.ProductAttribute) []map[string]string {
+	combinations := []map[string]string{{}}
+	for _, definition := range definitions {
+		next := make([]map[string]string, 0, len(combinations)*len(definition.Options))
+		for _, combination := range combinations {
+			for _, option := range definition.Options {
+				extended := make(map[string]string, len(combination)+1)
+				for name, value := range combination {
+					extended[name] = value
+				}
+				extended[definition.Name] = option
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// combinationKey identifies a set of attribute values independent of map order and case
+func combinationKey(definitions []models.ProductAttribute, attributes map[string]string) string {
+	values := make([]string, len(definitions))
+	for i, definition := range definitions {
+		value, _ := lookupAttribute(attributes, definition.Name)
+		values[i] = strings.ToLower(value)
+	}
+	return strings.Join(values, "\x00")
+}
+
+var (
+	skuPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+	skuUnsafe      = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// renderSKU fills {product} and {<attribute>} placeholders with upper-case, dash-separated values
+func renderSKU(template, productName string, definitions []models.ProductAttribute, combination map[string]string) (string, error) {
+	var unknown string
+	sku := skuPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := strings.TrimSpace(placeholder[1 : len(placeholder)-1])
+		if strings.EqualFold(name, "product") {
+			return skuPart(productName)
+		}
+		if value, ok := lookupAttribute(combination, name); ok {
+			return skuPart(value)
+		}
+		unknown = name
+		return ""
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("%w: {%s}", ErrInvalidSKUTemplate, unknown)
+	}
+	return sku, nil
+}
+
+func skuPart(value string) string {
+	return strings.Trim(skuUnsafe.ReplaceAllString(strings.ToUpper(value), "-"), "-")
+}
+
+func matchOption(options []string, value string) (string, bool) {
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+func lookupAttribute(attributes map[string]string, name string) (string, bool) {
+	for key, value := range attributes {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
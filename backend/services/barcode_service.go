@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bstock/models"
+	"bstock/utils"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidPLU = errors.New("PLU must be 1 to 9 digits and not all zeros")
+	ErrPLUInUse   = errors.New("PLU is already assigned to another variant")
+)
+
+// BarcodeInUseError is returned when a code is already assigned to another variant of the organization
+type BarcodeInUseError struct {
+	Code      string
+	VariantID uuid.UUID
+}
+
+func (e *BarcodeInUseError) Error() string {
+	return fmt.Sprintf("barcode %s is already assigned to variant %s", e.Code, e.VariantID)
+}
+
+// ScaleUnitError is returned when a weight-embedded scale barcode resolves to a variant not sold by weight
+type ScaleUnitError struct {
+	VariantID uuid.UUID
+	UnitType  string
+}
+
+func (e *ScaleUnitError) Error() string {
+	return fmt.Sprintf("scale barcode carries a weight but variant %s is sold in %s", e.VariantID, e.UnitType)
+}
+
+type BarcodeService struct{}
+
+func NewBarcodeService() *BarcodeService {
+	return &BarcodeService{}
+}
+
+// SetBarcodes validates codes and replaces the variant's barcodes with them.
+// Errors wrap utils.ErrInvalidBarcode for malformed codes or are a *BarcodeInUseError.
+func (s *BarcodeService) SetBarcodes(tx *gorm.DB, orgID, variantID uuid.UUID, codes []string) ([]models.Barcode, error) {
+	barcodes := make([]models.Barcode, 0, len(codes))
+	seen := make(map[string]bool, len(codes))
+	values := make([]string, 0, len(codes))
+	for _, raw := range codes {
+		code, symbology, err := utils.ParseBarcode(raw)
+		if err != nil {
+			return nil, err
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		values = append(values, code)
+
+		barcodes = append(barcodes, models.Barcode{
+			OrganizationID: orgID,
+			VariantID:      variantID,
+			Code:           code,
+			Symbology:      symbology,
+		})
+	}
+
+	if len(values) > 0 {
+		var taken models.Barcode
+		err := tx.Where("organization_id = ? AND code IN ? AND variant_id <> ?", orgID, values, variantID).
+			First(&taken).Error
+		if err == nil {
+			return nil, &BarcodeInUseError{Code: taken.Code, VariantID: taken.VariantID}
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if err := tx.Where("variant_id = ?", variantID).Delete(&models.Barcode{}).Error; err != nil {
+		return nil, err
+	}
+	if len(barcodes) > 0 {
+		if err := tx.Create(&barcodes).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return barcodes, nil
+}
+
+// FindVariant returns the organization's variant carrying the scanned code
+func (s *BarcodeService) FindVariant(tx *gorm.DB, orgID uuid.UUID, code string) (*models.Variant, error) {
+	var barcode models.Barcode
+	if err := tx.Where("organization_id = ? AND code IN ?", orgID, utils.BarcodeLookupCandidates(code)).
+		First(&barcode).Error; err != nil {
+		return nil, err
+	}
+
+	var variant models.Variant
+	if err := tx.Joins("JOIN products ON products.id = variants.product_id").
+		Where("variants.id = ? AND variants.status = ? AND products.status = ?", barcode.VariantID, models.CatalogStatusActive, models.CatalogStatusActive).
+		Preload("Product").
+		Preload("Barcodes").
+		Preload("StockLevels.Location").
+		First(&variant).Error; err != nil {
+		return nil, err
+	}
+
+	return &variant, nil
+}
+
+// ScaleReading is what a scale barcode says about the line it was printed for
+type ScaleReading struct {
+	Prefix     string   `json:"prefix"`
+	PLU        string   `json:"plu"`
+	ValueType  string   `json:"value_type"`
+	Weight     *float64 `json:"weight,omitempty"` // In kg, for weight barcodes
+	Quantity   float64  `json:"quantity"`         // In the variant's unit
+	LineAmount float64  `json:"line_amount"`
+}
+
+// ScannedVariant is the variant behind a scanned code, with the decoded reading for scale barcodes
+type ScannedVariant struct {
+	*models.Variant
+	Scale *ScaleReading `json:"scale,omitempty"`
+}
+
+// Scan resolves a scanned code to a variant. Codes assigned to a variant win; otherwise an in-store
+// EAN-13 matching one of the organization's scale formats is decoded into a PLU and a weight or price.
+// A weight only scans for variants sold in kg or g, and is never rounded to fit the unit.
+func (s *BarcodeService) Scan(tx *gorm.DB, orgID uuid.UUID, code string) (*ScannedVariant, error) {
+	variant, err := s.FindVariant(tx, orgID, code)
+	if err == nil {
+		return &ScannedVariant{Variant: variant}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	prefix, ok := utils.ScaleBarcodePrefix(code)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var format models.ScaleBarcodeFormat
+	if err := tx.Where("organization_id = ? AND prefix = ?", orgID, prefix).First(&format).Error; err != nil {
+		return nil, err
+	}
+
+	plu, value, err := utils.DecodeScaleBarcode(code, format.PLULength, format.ValueDecimals)
+	if err != nil {
+		return nil, err
+	}
+
+	variant = &models.Variant{}
+	if err := tx.Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ? AND variants.plu <> '' AND LTRIM(variants.plu, '0') = ?", orgID, normalizePLU(plu)).
+		Where("variants.status = ? AND products.status = ?", models.CatalogStatusActive, models.CatalogStatusActive).
+		Preload("Product").
+		Preload("Barcodes").
+		Preload("StockLevels.Location").
+		First(variant).Error; err != nil {
+		return nil, err
+	}
+
+	reading := &ScaleReading{
+		Prefix:    prefix,
+		PLU:       plu,
+		ValueType: format.ValueType,
+	}
+	if format.ValueType == models.ScaleValueWeight {
+		weight := value
+		reading.Weight = &weight
+		switch strings.ToLower(variant.UnitType) {
+		case "kg":
+			reading.Quantity = weight
+		case "g":
+			reading.Quantity = weight * 1000
+		default:
+			return nil, &ScaleUnitError{VariantID: variant.ID, UnitType: variant.UnitType}
+		}
+		// A weight finer than the unit is counted to would change the sale line if rounded
+		if !models.ValidQuantity(reading.Quantity, variant.UnitType) {
+			return nil, &QuantityPrecisionError{VariantID: variant.ID, UnitType: variant.UnitType, Quantity: reading.Quantity}
+		}
+		reading.Quantity = models.RoundToUnit(reading.Quantity, variant.UnitType)
+		reading.LineAmount = roundAmount(reading.Quantity * variant.SalePrice)
+	} else {
+		reading.LineAmount = value
+		if variant.SalePrice > 0 {
+			reading.Quantity = models.RoundToUnit(value/variant.SalePrice, variant.UnitType)
+		}
+	}
+
+	return &ScannedVariant{Variant: variant, Scale: reading}, nil
+}
+
+// ValidatePLU checks a PLU is well formed and not used by another of the organization's variants.
+// Pass uuid.Nil as variantID for a variant that is being created.
+func (s *BarcodeService) ValidatePLU(tx *gorm.DB, orgID, variantID uuid.UUID, plu string) error {
+	if plu == "" {
+		return nil
+	}
+	if !utils.ValidPLU(plu) {
+		return ErrInvalidPLU
+	}
+
+	var count int64
+	if err := tx.Model(&models.Variant{}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ? AND variants.plu <> '' AND LTRIM(variants.plu, '0') = ? AND variants.id <> ?", orgID, normalizePLU(plu), variantID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPLUInUse
+	}
+	return nil
+}
+
+// normalizePLU drops leading zeros, which scales add to pad the PLU to the format's length
+func normalizePLU(plu string) string {
+	return strings.TrimLeft(plu, "0")
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
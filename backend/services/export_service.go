@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bstock/database"
+	"bstock/models"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// ExportColumns are the catalog import columns followed by the value of stock on hand
+var ExportColumns = append(append([]string{}, CatalogColumns...), "stock_value")
+
+type ExportService struct{}
+
+func NewExportService() *ExportService {
+	return &ExportService{}
+}
+
+// ExportCatalog streams one row per variant, header first, to write. Rows are read from a cursor so
+// large catalogs are never loaded at once. With a location, quantity and value are for that location only.
+func (s *ExportService) ExportCatalog(orgID uuid.UUID, locationID *uuid.UUID, write func(row []interface{}) error) error {
+	method, err := NewInventoryService().CostingMethod(database.DB, orgID)
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(ExportColumns))
+	for i, column := range ExportColumns {
+		header[i] = column
+	}
+	if err := write(header); err != nil {
+		return err
+	}
+
+	quantityColumn := "variants.quantity"
+	query := database.DB.Table("variants").
+		Joins("JOIN products ON products.id = variants.product_id").
+		Joins("LEFT JOIN vendors ON vendors.id = products.vendor_id").
+		Joins(`LEFT JOIN (
+			SELECT variant_id, SUM(quantity_remaining) as quantity, SUM(quantity_remaining * unit_cost) as value
+			FROM cost_layers
+			WHERE quantity_remaining > 0
+			GROUP BY variant_id
+		) layers ON layers.variant_id = variants.id`).
+		Where("products.organization_id = ? AND variants.status <> ?", orgID, models.CatalogStatusArchived)
+
+	if locationID != nil {
+		quantityColumn = "COALESCE(stock_levels.quantity, 0)"
+		query = query.Joins("LEFT JOIN stock_levels ON stock_levels.variant_id = variants.id AND stock_levels.location_id = ?", *locationID)
+	}
+
+	rows, err := query.
+		Select("products.name as product_name, products.description, products.category, " +
+			"COALESCE(vendors.name, '') as vendor_name, variants.sku, variants.plu, " +
+			"COALESCE((SELECT string_agg(code, '|' ORDER BY code) FROM barcodes WHERE barcodes.variant_id = variants.id), '') as barcodes, " +
+			"variants.attributes::text as attributes, variants.unit_type, variants.purchase_price, variants.sale_price, " +
+			quantityColumn + " as quantity, variants.min_stock_level, " +
+			"COALESCE(layers.quantity, 0) as layer_quantity, COALESCE(layers.value, 0) as layer_value").
+		Order("products.name ASC, variants.position ASC, variants.sku ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row struct {
+			ProductName   string
+			Description   string
+			Category      string
+			VendorName    string
+			SKU           string
+			PLU           string
+			Barcodes      string
+			Attributes    string
+			UnitType      string
+			PurchasePrice float64
+			SalePrice     float64
+			Quantity      float64
+			MinStockLevel float64
+			LayerQuantity float64
+			LayerValue    float64
+		}
+		if err := database.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+
+		attributes := map[string]string{}
+		if row.Attributes != "" {
+			if err := json.Unmarshal([]byte(row.Attributes), &attributes); err != nil {
+				return err
+			}
+		}
+
+		unitCost := row.PurchasePrice
+		if method == models.CostingMethodFIFO && row.LayerQuantity > 0 {
+			unitCost = row.LayerValue / row.LayerQuantity
+		}
+
+		if err := write([]interface{}{
+			row.ProductName,
+			row.Description,
+			row.Category,
+			row.VendorName,
+			row.SKU,
+			row.PLU,
+			row.Barcodes,
+			FormatAttributes(attributes),
+			row.UnitType,
+			row.PurchasePrice,
+			row.SalePrice,
+			row.Quantity,
+			row.MinStockLevel,
+			roundAmount(unitCost * row.Quantity),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bstock/events"
+	"bstock/models"
+	"bstock/storage"
+	"bstock/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"time"
+
+	// Register decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	MaxImageSize   = 5 << 20 // Bytes accepted per upload
+	ThumbnailSize  = 256     // Longest side of POS grid thumbnails, in pixels
+	maxImagePixels = 25_000_000
+)
+
+var (
+	ErrImageTooLarge    = errors.New("image exceeds the maximum upload size")
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+	ErrImageNotFound    = errors.New("image not found")
+)
+
+// imageExtensions maps accepted content types, sniffed from the data rather than trusted from the client
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageUpload describes a product or variant photo to store
+type ImageUpload struct {
+	OrganizationID uuid.UUID
+	ProductID      uuid.UUID
+	VariantID      *uuid.UUID
+	Data           []byte
+}
+
+type ImageService struct{}
+
+func NewImageService() *ImageService {
+	return &ImageService{}
+}
+
+// Upload validates the image, stores the original and a JPEG thumbnail, and records it after the product's other images
+func (s *ImageService) Upload(tx *gorm.DB, input ImageUpload) (*models.ProductImage, error) {
+	if len(input.Data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(input.Data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(input.Data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, utils.Thumbnail(decoded, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	var position int
+	if err := tx.Model(&models.ProductImage{}).
+		Where("product_id = ?", input.ProductID).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&position).Error; err != nil {
+		return nil, err
+	}
+
+	imageID := uuid.New()
+	prefix := fmt.Sprintf("orgs/%s/products/%s/%s", input.OrganizationID, input.ProductID, imageID)
+	record := models.ProductImage{
+		OrganizationID: input.OrganizationID,
+		ProductID:      input.ProductID,
+		VariantID:      input.VariantID,
+		StorageKey:     prefix + extension,
+		ThumbnailKey:   prefix + "_thumb.jpg",
+		ContentType:    contentType,
+		Size:           int64(len(input.Data)),
+		Width:          config.Width,
+		Height:         config.Height,
+		Position:       position,
+	}
+	record.ID = imageID
+
+	if err := storage.Default.Put(record.StorageKey, bytes.NewReader(input.Data), record.Size, contentType); err != nil {
+		return nil, err
+	}
+	if err := storage.Default.Put(record.ThumbnailKey, &thumbnail, int64(thumbnail.Len()), "image/jpeg"); err != nil {
+		s.deleteFiles(record)
+		return nil, err
+	}
+
+	if err := tx.Create(&record).Error; err != nil {
+		s.deleteFiles(record)
+		return nil, err
+	}
+	if err := touchProduct(tx, record.OrganizationID, record.ProductID); err != nil {
+		s.deleteFiles(record)
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Delete removes an image of the product and returns it. The caller owns the transaction and
+// removes the stored files with DeleteFiles once it has committed.
+func (s *ImageService) Delete(tx *gorm.DB, orgID, productID, imageID uuid.UUID) (*models.ProductImage, error) {
+	var record models.ProductImage
+	if err := tx.Where("id = ? AND product_id = ? AND organization_id = ?", imageID, productID, orgID).
+		First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+
+	if err := tx.Delete(&record).Error; err != nil {
+		return nil, err
+	}
+	if err := touchProduct(tx, record.OrganizationID, record.ProductID); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteFiles removes the stored files of images whose rows are gone
+func (s *ImageService) DeleteFiles(images []models.ProductImage) {
+	for _, record := range images {
+		s.deleteFiles(record)
+	}
+}
+
+// deleteFiles is best effort: an orphaned file is harmless, a failed request because of one is not
+func (s *ImageService) deleteFiles(record models.ProductImage) {
+	for _, key := range []string{record.StorageKey, record.ThumbnailKey} {
+		if err := storage.Default.Delete(key); err != nil {
+			log.Printf("Failed to delete stored file %s: %v", key, err)
+		}
+	}
+}
+
+// touchProduct bumps the product's updated_at so catalog sync picks up its changed images, and tells terminals
+func touchProduct(tx *gorm.DB, orgID, productID uuid.UUID) error {
+	if err := tx.Model(&models.Product{}).Where("id = ?", productID).Update("updated_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return events.PublishCatalog(tx, orgID, events.CatalogChanged{
+		Entity:    "product",
+		ID:        &productID,
+		ProductID: &productID,
+		Action:    events.ActionUpdated,
+	})
+}
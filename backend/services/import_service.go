@@ -0,0 +1,532 @@
+package services
+
+import (
+	"bstock/models"
+	"bstock/utils"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CatalogColumns are the spreadsheet columns shared by catalog import and export.
+// Variants of one product are consecutive rows repeating the product columns.
+var CatalogColumns = []string{
+	"product_name",
+	"description",
+	"category",
+	"vendor",
+	"sku",
+	"plu",
+	"barcodes",   // Separated by "|"
+	"attributes", // "Size=L; Color=Red"
+	"unit_type",
+	"purchase_price",
+	"sale_price",
+	"quantity", // Opening stock on import
+	"min_stock_level",
+}
+
+var (
+	ErrImportEmpty      = errors.New("import file has no data rows")
+	ErrImportInvalid    = errors.New("import file has invalid rows")
+	ErrImportOverLimit  = errors.New("import exceeds the plan's product limit")
+	errImportMissingCol = errors.New("missing required column")
+)
+
+// ImportRowError reports a problem with one cell of an import file. Row numbers match the spreadsheet.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarises an import, whether it was a dry run or committed
+type ImportReport struct {
+	DryRun      bool             `json:"dry_run"`
+	Imported    bool             `json:"imported"`
+	Rows        int              `json:"rows"`
+	NewProducts int              `json:"new_products"`
+	Variants    int              `json:"variants"`
+	NewVendors  int              `json:"new_vendors"`
+	Errors      []ImportRowError `json:"errors"`
+}
+
+// ImportInput describes a catalog import
+type ImportInput struct {
+	OrganizationID uuid.UUID
+	UserID         uuid.UUID
+	LocationID     *uuid.UUID // Where opening stock is held
+	Records        [][]string // Header row followed by data rows
+	DryRun         bool
+	ProductLimit   *int64 // Products the plan still allows, nil for unlimited
+}
+
+type importVariant struct {
+	row           int
+	sku           string
+	plu           string
+	barcodes      []string
+	attributes    map[string]string
+	unitType      string
+	purchasePrice float64
+	salePrice     float64
+	quantity      float64
+	minStockLevel float64
+}
+
+type importProduct struct {
+	name        string
+	description string
+	category    string
+	vendor      string
+	existingID  *uuid.UUID
+	variants    []importVariant
+}
+
+type ImportService struct{}
+
+func NewImportService() *ImportService {
+	return &ImportService{}
+}
+
+// ImportCatalog validates every row and, unless it is a dry run, creates the products, variants,
+// vendors and opening stock inside tx. Rows naming an existing product add variants to it.
+// Validation problems are returned in the report together with ErrImportInvalid; the caller owns the transaction.
+func (s *ImportService) ImportCatalog(tx *gorm.DB, input ImportInput) (*ImportReport, error) {
+	report := &ImportReport{DryRun: input.DryRun, Errors: []ImportRowError{}}
+
+	products, err := s.parse(input.Records, report)
+	if err != nil {
+		return report, err
+	}
+	if report.Rows == 0 {
+		return report, ErrImportEmpty
+	}
+
+	if err := s.validateAgainstCatalog(tx, input.OrganizationID, products, report); err != nil {
+		return report, err
+	}
+
+	vendors, err := s.vendorIDs(tx, input.OrganizationID)
+	if err != nil {
+		return report, err
+	}
+	newVendors := make(map[string]bool)
+	for _, product := range products {
+		if product.existingID == nil {
+			report.NewProducts++
+		}
+		report.Variants += len(product.variants)
+		if key := strings.ToLower(product.vendor); key != "" && vendors[key] == uuid.Nil {
+			newVendors[key] = true
+		}
+	}
+	report.NewVendors = len(newVendors)
+
+	if input.ProductLimit != nil && int64(report.NewProducts) > *input.ProductLimit {
+		report.Errors = append(report.Errors, ImportRowError{
+			Message: fmt.Sprintf("import adds %d products but the plan allows %d more", report.NewProducts, *input.ProductLimit),
+		})
+		return report, ErrImportOverLimit
+	}
+
+	if len(report.Errors) > 0 {
+		return report, ErrImportInvalid
+	}
+	if input.DryRun {
+		return report, nil
+	}
+
+	if err := s.apply(tx, input, products, vendors); err != nil {
+		return report, err
+	}
+
+	report.Imported = true
+	return report, nil
+}
+
+// parse maps columns by header name and checks each row on its own
+func (s *ImportService) parse(records [][]string, report *ImportReport) ([]*importProduct, error) {
+	if len(records) == 0 {
+		return nil, ErrImportEmpty
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"product_name", "sku", "sale_price"} {
+		if _, ok := columns[required]; !ok {
+			report.Errors = append(report.Errors, ImportRowError{Row: 1, Column: required, Message: errImportMissingCol.Error()})
+		}
+	}
+	if len(report.Errors) > 0 {
+		return nil, ErrImportInvalid
+	}
+
+	var products []*importProduct
+	byName := make(map[string]*importProduct)
+
+	for i, record := range records[1:] {
+		rowNumber := i + 2
+		cell := func(column string) string {
+			if index, ok := columns[column]; ok && index < len(record) {
+				return utils.UnescapeSpreadsheetText(strings.TrimSpace(record[index]))
+			}
+			return ""
+		}
+		addError := func(column, message string) {
+			report.Errors = append(report.Errors, ImportRowError{Row: rowNumber, Column: column, Message: message})
+		}
+		number := func(column string, required bool) float64 {
+			raw := cell(column)
+			if raw == "" {
+				if required {
+					addError(column, "is required")
+				}
+				return 0
+			}
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				addError(column, "must be a number")
+				return 0
+			}
+			if value < 0 {
+				addError(column, "cannot be negative")
+			}
+			return value
+		}
+
+		blank := true
+		for _, value := range record {
+			if strings.TrimSpace(value) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+		report.Rows++
+
+		variant := importVariant{
+			row:           rowNumber,
+			sku:           cell("sku"),
+			plu:           cell("plu"),
+			unitType:      cell("unit_type"),
+			purchasePrice: number("purchase_price", false),
+			salePrice:     number("sale_price", true),
+			quantity:      number("quantity", false),
+			minStockLevel: number("min_stock_level", false),
+		}
+		if variant.unitType == "" {
+			variant.unitType = "pcs"
+		}
+
+		name := cell("product_name")
+		if name == "" {
+			addError("product_name", "is required")
+		}
+		if variant.sku == "" {
+			addError("sku", "is required")
+		}
+		if value, err := strconv.ParseFloat(cell("sale_price"), 64); err == nil && value == 0 {
+			addError("sale_price", "must be greater than zero")
+		}
+		if !models.ValidQuantity(variant.quantity, variant.unitType) {
+			addError("quantity", fmt.Sprintf("%s allows %d decimals", variant.unitType, models.QuantityPrecision(variant.unitType)))
+		}
+		if variant.plu != "" && !utils.ValidPLU(variant.plu) {
+			addError("plu", ErrInvalidPLU.Error())
+		}
+
+		for _, raw := range strings.Split(cell("barcodes"), "|") {
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+			code, _, err := utils.ParseBarcode(raw)
+			if err != nil {
+				addError("barcodes", err.Error())
+				continue
+			}
+			variant.barcodes = append(variant.barcodes, code)
+		}
+
+		attributes, err := parseAttributes(cell("attributes"))
+		if err != nil {
+			addError("attributes", err.Error())
+		}
+		variant.attributes = attributes
+
+		if name == "" {
+			continue
+		}
+
+		key := strings.ToLower(name)
+		product, ok := byName[key]
+		if !ok {
+			product = &importProduct{
+				name:        name,
+				description: cell("description"),
+				category:    cell("category"),
+				vendor:      cell("vendor"),
+			}
+			byName[key] = product
+			products = append(products, product)
+		}
+		product.variants = append(product.variants, variant)
+	}
+
+	return products, nil
+}
+
+// validateAgainstCatalog checks uniqueness within the file and against the organization's existing catalog
+func (s *ImportService) validateAgainstCatalog(tx *gorm.DB, orgID uuid.UUID, products []*importProduct, report *ImportReport) error {
+	var existing []struct {
+		ID     uuid.UUID
+		Name   string
+		Status string
+	}
+	if err := tx.Model(&models.Product{}).Where("organization_id = ?", orgID).Select("id, name, status").Scan(&existing).Error; err != nil {
+		return err
+	}
+	// Rows only add variants to products still in the catalog; archived ones must be unarchived first
+	productIDs := make(map[string]uuid.UUID, len(existing))
+	archivedNames := make(map[string]bool)
+	for _, p := range existing {
+		if p.Status == models.CatalogStatusArchived {
+			archivedNames[strings.ToLower(p.Name)] = true
+		} else {
+			productIDs[strings.ToLower(p.Name)] = p.ID
+		}
+	}
+
+	var skus, plus, codes []string
+	if err := tx.Model(&models.Variant{}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ?", orgID).
+		Pluck("LOWER(variants.sku)", &skus).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Variant{}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ? AND variants.plu <> ''", orgID).
+		Pluck("LTRIM(variants.plu, '0')", &plus).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Barcode{}).Where("organization_id = ?", orgID).Pluck("code", &codes).Error; err != nil {
+		return err
+	}
+
+	takenSKUs := toSet(skus)
+	takenPLUs := toSet(plus)
+	takenCodes := toSet(codes)
+
+	fileSKUs := make(map[string]int)
+	filePLUs := make(map[string]int)
+	fileCodes := make(map[string]int)
+
+	for _, product := range products {
+		var definitions []models.ProductAttribute
+		if id, ok := productIDs[strings.ToLower(product.name)]; ok {
+			product.existingID = &id
+
+			var err error
+			if definitions, err = NewAttributeService().Definitions(tx, id); err != nil {
+				return err
+			}
+		} else if archivedNames[strings.ToLower(product.name)] {
+			report.Errors = append(report.Errors, ImportRowError{
+				Row:     product.variants[0].row,
+				Column:  "product_name",
+				Message: "matches an archived product; unarchive it or use another name",
+			})
+		}
+
+		for i := range product.variants {
+			variant := &product.variants[i]
+			addError := func(column, message string) {
+				report.Errors = append(report.Errors, ImportRowError{Row: variant.row, Column: column, Message: message})
+			}
+
+			// Variants added to an existing product must fit its attribute definitions
+			if attributes, err := NormalizeAttributes(definitions, variant.attributes); err != nil {
+				addError("attributes", err.Error())
+			} else {
+				variant.attributes = attributes
+			}
+
+			if sku := strings.ToLower(variant.sku); sku != "" {
+				if takenSKUs[sku] {
+					addError("sku", "already exists in the catalog")
+				} else if row, ok := fileSKUs[sku]; ok {
+					addError("sku", fmt.Sprintf("duplicates row %d", row))
+				} else {
+					fileSKUs[sku] = variant.row
+				}
+			}
+
+			if utils.ValidPLU(variant.plu) {
+				plu := normalizePLU(variant.plu)
+				if takenPLUs[plu] {
+					addError("plu", ErrPLUInUse.Error())
+				} else if row, ok := filePLUs[plu]; ok {
+					addError("plu", fmt.Sprintf("duplicates row %d", row))
+				} else {
+					filePLUs[plu] = variant.row
+				}
+			}
+
+			for _, code := range variant.barcodes {
+				if takenCodes[code] {
+					addError("barcodes", fmt.Sprintf("%s is already assigned to another variant", code))
+				} else if row, ok := fileCodes[code]; ok && row != variant.row {
+					addError("barcodes", fmt.Sprintf("%s duplicates row %d", code, row))
+				} else {
+					fileCodes[code] = variant.row
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *ImportService) vendorIDs(tx *gorm.DB, orgID uuid.UUID) (map[string]uuid.UUID, error) {
+	var vendors []models.Vendor
+	if err := tx.Where("organization_id = ?", orgID).Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uuid.UUID, len(vendors))
+	for _, vendor := range vendors {
+		ids[strings.ToLower(vendor.Name)] = vendor.ID
+	}
+	return ids, nil
+}
+
+func (s *ImportService) apply(tx *gorm.DB, input ImportInput, products []*importProduct, vendors map[string]uuid.UUID) error {
+	inventoryService := NewInventoryService()
+	barcodeService := NewBarcodeService()
+
+	for _, product := range products {
+		var vendorID *uuid.UUID
+		if product.vendor != "" {
+			key := strings.ToLower(product.vendor)
+			if vendors[key] == uuid.Nil {
+				vendor := models.Vendor{OrganizationID: input.OrganizationID, Name: product.vendor}
+				if err := tx.Create(&vendor).Error; err != nil {
+					return err
+				}
+				vendors[key] = vendor.ID
+			}
+			id := vendors[key]
+			vendorID = &id
+		}
+
+		productID := uuid.Nil
+		if product.existingID != nil {
+			productID = *product.existingID
+		} else {
+			record := models.Product{
+				OrganizationID: input.OrganizationID,
+				Name:           product.name,
+				Description:    product.description,
+				Category:       product.category,
+				VendorID:       vendorID,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			productID = record.ID
+		}
+
+		position, err := NewVariantService().NextPosition(tx, productID)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range product.variants {
+			variant := models.Variant{
+				ProductID:     productID,
+				Attributes:    row.attributes,
+				SKU:           row.sku,
+				PLU:           row.plu,
+				PurchasePrice: row.purchasePrice,
+				SalePrice:     row.salePrice,
+				MinStockLevel: row.minStockLevel,
+				UnitType:      row.unitType,
+				Position:      position + i,
+			}
+			if err := tx.Create(&variant).Error; err != nil {
+				return fmt.Errorf("row %d: %w", row.row, err)
+			}
+
+			if len(row.barcodes) > 0 {
+				if _, err := barcodeService.SetBarcodes(tx, input.OrganizationID, variant.ID, row.barcodes); err != nil {
+					return fmt.Errorf("row %d: %w", row.row, err)
+				}
+			}
+
+			if row.quantity != 0 {
+				if _, err := inventoryService.ApplyStockChange(tx, &variant, StockChange{
+					OrganizationID: input.OrganizationID,
+					LocationID:     input.LocationID,
+					UserID:         input.UserID,
+					Delta:          row.quantity,
+					ReasonCode:     models.MovementReasonInitial,
+					SourceType:     models.MovementSourceAdjustment,
+					Note:           "Imported opening stock",
+				}); err != nil {
+					return fmt.Errorf("row %d: %w", row.row, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseAttributes reads "Size=L; Color=Red" into a map
+func parseAttributes(raw string) (map[string]string, error) {
+	attributes := map[string]string{}
+	for _, pair := range strings.Split(raw, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%q must be written as Name=Value", pair)
+		}
+		attributes[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return attributes, nil
+}
+
+// FormatAttributes writes attributes in the form parseAttributes reads, with keys sorted
+func FormatAttributes(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+attributes[key])
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
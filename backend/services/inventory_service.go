@@ -0,0 +1,448 @@
+package services
+
+import (
+	"bstock/database"
+	"bstock/events"
+	"bstock/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNegativeStock = errors.New("stock cannot be negative")
+	ErrPackNotFound  = errors.New("pack unit not found")
+	ErrDuplicatePack = errors.New("pack unit names must be unique per variant")
+)
+
+// QuantityPrecisionError is returned when a quantity has more decimals than the variant's unit allows
+type QuantityPrecisionError struct {
+	VariantID uuid.UUID
+	UnitType  string
+	Quantity  float64
+}
+
+func (e *QuantityPrecisionError) Error() string {
+	return fmt.Sprintf("quantity %g is not allowed for variant %s: %s is counted to %d decimals",
+		e.Quantity, e.VariantID, e.UnitType, models.QuantityPrecision(e.UnitType))
+}
+
+type InventoryService struct{}
+
+func NewInventoryService() *InventoryService {
+	return &InventoryService{}
+}
+
+// StockChange describes a single quantity change to be posted to the ledger
+type StockChange struct {
+	OrganizationID uuid.UUID
+	LocationID     *uuid.UUID // Defaults to the organization's default location
+	UserID         uuid.UUID
+	Delta          float64
+	ReasonCode     string
+	SourceType     string
+	SourceID       *uuid.UUID
+	Note           string
+	AllowNegative  bool
+	UnitCost       *float64 // Cost of incoming goods, defaults to the variant's current cost
+}
+
+// LockVariant loads a variant belonging to the organization and locks its row for the rest of tx
+func (s *InventoryService) LockVariant(tx *gorm.DB, orgID, variantID uuid.UUID) (*models.Variant, error) {
+	var variant models.Variant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "variants"}}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("variants.id = ? AND products.organization_id = ?", variantID, orgID).
+		First(&variant).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// LockStockLevel loads the variant's balance at a location, creating an empty one if needed, and locks it.
+// Lock the variant first so concurrent changes always acquire locks in the same order.
+func (s *InventoryService) LockStockLevel(tx *gorm.DB, variantID, locationID uuid.UUID) (*models.StockLevel, error) {
+	empty := models.StockLevel{
+		VariantID:  variantID,
+		LocationID: locationID,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&empty).Error; err != nil {
+		return nil, err
+	}
+
+	var level models.StockLevel
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND location_id = ?", variantID, locationID).
+		First(&level).Error; err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+// ApplyStockChange updates the variant's balance at a location and its total quantity,
+// then appends the matching stock movement.
+// The variant should have been locked with LockVariant inside the same transaction.
+func (s *InventoryService) ApplyStockChange(tx *gorm.DB, variant *models.Variant, change StockChange) (*models.StockMovement, error) {
+	if !models.ValidQuantity(change.Delta, variant.UnitType) {
+		return nil, &QuantityPrecisionError{VariantID: variant.ID, UnitType: variant.UnitType, Quantity: change.Delta}
+	}
+
+	locationID, err := NewLocationService().ResolveLocationID(tx, change.OrganizationID, change.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := s.LockStockLevel(tx, variant.ID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	newLevelQuantity := models.RoundQuantity(level.Quantity + change.Delta)
+	if newLevelQuantity < 0 && !change.AllowNegative {
+		return nil, ErrNegativeStock
+	}
+
+	if err := tx.Model(level).Update("quantity", newLevelQuantity).Error; err != nil {
+		return nil, err
+	}
+
+	unitCost, err := s.applyCost(tx, variant, change)
+	if err != nil {
+		return nil, err
+	}
+
+	newQuantity := models.RoundQuantity(variant.Quantity + change.Delta)
+	if err := tx.Model(variant).Update("quantity", newQuantity).Error; err != nil {
+		return nil, err
+	}
+	variant.Quantity = newQuantity
+
+	movement := models.StockMovement{
+		OrganizationID:       change.OrganizationID,
+		VariantID:            variant.ID,
+		LocationID:           &locationID,
+		UserID:               change.UserID,
+		Delta:                change.Delta,
+		BalanceAfter:         newQuantity,
+		LocationBalanceAfter: newLevelQuantity,
+		UnitCost:             unitCost,
+		ReasonCode:           change.ReasonCode,
+		SourceType:           change.SourceType,
+		SourceID:             change.SourceID,
+		Note:                 change.Note,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+
+	// Delivered to other terminals once the transaction commits
+	if err := events.PublishStock(tx, change.OrganizationID, events.StockChanged{
+		VariantID:     variant.ID,
+		ProductID:     variant.ProductID,
+		LocationID:    locationID,
+		Quantity:      newLevelQuantity,
+		TotalQuantity: newQuantity,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &movement, nil
+}
+
+// applyCost maintains the variant's cost for a stock change and returns the unit cost of the goods moved.
+// Incoming goods open a cost layer and are blended into the weighted average held in PurchasePrice.
+// Outgoing goods consume the oldest layers and are valued by the organization's costing method.
+// It must run before the variant's quantity is updated.
+func (s *InventoryService) applyCost(tx *gorm.DB, variant *models.Variant, change StockChange) (float64, error) {
+	// Moving goods between locations does not change what they cost
+	if change.ReasonCode == models.MovementReasonTransferOut || change.ReasonCode == models.MovementReasonTransferIn || change.Delta == 0 {
+		return variant.PurchasePrice, nil
+	}
+
+	if change.Delta > 0 {
+		unitCost := variant.PurchasePrice
+		if change.UnitCost != nil {
+			unitCost = *change.UnitCost
+		}
+
+		layer := models.CostLayer{
+			OrganizationID:    change.OrganizationID,
+			VariantID:         variant.ID,
+			QuantityReceived:  change.Delta,
+			QuantityRemaining: change.Delta,
+			UnitCost:          unitCost,
+			SourceType:        change.SourceType,
+			SourceID:          change.SourceID,
+		}
+		if err := tx.Create(&layer).Error; err != nil {
+			return 0, err
+		}
+
+		if averageCost := weightedAverageCost(variant.Quantity, variant.PurchasePrice, change.Delta, unitCost); averageCost != variant.PurchasePrice {
+			if err := tx.Model(variant).Update("purchase_price", averageCost).Error; err != nil {
+				return 0, err
+			}
+			variant.PurchasePrice = averageCost
+		}
+
+		return unitCost, nil
+	}
+
+	quantity := -change.Delta
+	fifoCost, err := s.consumeCostLayers(tx, variant, quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	method, err := s.CostingMethod(tx, change.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	if method == models.CostingMethodFIFO {
+		return fifoCost / quantity, nil
+	}
+	return variant.PurchasePrice, nil
+}
+
+// consumeCostLayers draws quantity from the variant's oldest cost layers and returns their total cost.
+// Anything beyond the recorded layers, such as overselling into negative stock, is valued at the current cost.
+func (s *InventoryService) consumeCostLayers(tx *gorm.DB, variant *models.Variant, quantity float64) (float64, error) {
+	var layers []models.CostLayer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND quantity_remaining > 0", variant.ID).
+		Order("created_at ASC").
+		Find(&layers).Error; err != nil {
+		return 0, err
+	}
+
+	before := make([]float64, len(layers))
+	for i := range layers {
+		before[i] = layers[i].QuantityRemaining
+	}
+
+	totalCost := drawCostLayers(layers, quantity, variant.PurchasePrice)
+	for i := range layers {
+		if layers[i].QuantityRemaining == before[i] {
+			continue
+		}
+		if err := tx.Model(&layers[i]).Update("quantity_remaining", layers[i].QuantityRemaining).Error; err != nil {
+			return 0, err
+		}
+	}
+	return totalCost, nil
+}
+
+// weightedAverageCost is the unit cost after receiving quantity at unitCost into onHand units valued
+// at currentCost. When nothing is on hand the receipt's cost is taken as is.
+func weightedAverageCost(onHand, currentCost, quantity, unitCost float64) float64 {
+	if onHand <= 0 {
+		return unitCost
+	}
+	return (onHand*currentCost + quantity*unitCost) / (onHand + quantity)
+}
+
+// drawCostLayers takes quantity from layers in order, reducing their remaining quantities in place,
+// and returns the cost of what was taken. Quantity beyond the layers is valued at fallbackCost.
+func drawCostLayers(layers []models.CostLayer, quantity, fallbackCost float64) float64 {
+	remaining := quantity
+	var totalCost float64
+	for i := range layers {
+		if remaining <= 0 {
+			break
+		}
+
+		take := layers[i].QuantityRemaining
+		if take > remaining {
+			take = remaining
+		}
+
+		layers[i].QuantityRemaining = models.RoundQuantity(layers[i].QuantityRemaining - take)
+		totalCost += take * layers[i].UnitCost
+		remaining = models.RoundQuantity(remaining - take)
+	}
+
+	if remaining > 0 {
+		totalCost += remaining * fallbackCost
+	}
+	return totalCost
+}
+
+// CostingMethod returns the costing method configured for the organization
+func (s *InventoryService) CostingMethod(tx *gorm.DB, orgID uuid.UUID) (string, error) {
+	var org models.Organization
+	if err := tx.Select("costing_method").First(&org, orgID).Error; err != nil {
+		return "", err
+	}
+	return org.CostingMethod, nil
+}
+
+// FindPack returns the variant's pack unit with the given name, ignoring case
+func (s *InventoryService) FindPack(tx *gorm.DB, variantID uuid.UUID, name string) (*models.PackUnit, error) {
+	var pack models.PackUnit
+	if err := tx.Where("variant_id = ? AND LOWER(name) = LOWER(?)", variantID, strings.TrimSpace(name)).
+		First(&pack).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrPackNotFound, name)
+		}
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// SetPacks replaces the variant's pack units
+func (s *InventoryService) SetPacks(tx *gorm.DB, variantID uuid.UUID, packs []models.PackUnit) ([]models.PackUnit, error) {
+	seen := make(map[string]bool, len(packs))
+	for i := range packs {
+		packs[i].VariantID = variantID
+		packs[i].Name = strings.TrimSpace(packs[i].Name)
+
+		key := strings.ToLower(packs[i].Name)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicatePack, packs[i].Name)
+		}
+		seen[key] = true
+	}
+
+	if err := tx.Where("variant_id = ?", variantID).Delete(&models.PackUnit{}).Error; err != nil {
+		return nil, err
+	}
+	if len(packs) > 0 {
+		if err := tx.Create(&packs).Error; err != nil {
+			return nil, err
+		}
+	}
+	return packs, nil
+}
+
+// UnitCosts returns the current unit cost of each variant under the organization's costing method:
+// the weighted average, or under FIFO the average of the cost layers still on hand.
+func (s *InventoryService) UnitCosts(tx *gorm.DB, orgID uuid.UUID, variantIDs []uuid.UUID) (map[uuid.UUID]float64, error) {
+	costs := make(map[uuid.UUID]float64, len(variantIDs))
+	if len(variantIDs) == 0 {
+		return costs, nil
+	}
+
+	method, err := s.CostingMethod(tx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		VariantID     uuid.UUID
+		AverageCost   float64
+		LayerQuantity float64
+		LayerValue    float64
+	}
+	if err := tx.Table("variants").
+		Select("variants.id as variant_id, variants.purchase_price as average_cost, "+
+			"COALESCE(SUM(cost_layers.quantity_remaining), 0) as layer_quantity, "+
+			"COALESCE(SUM(cost_layers.quantity_remaining * cost_layers.unit_cost), 0) as layer_value").
+		Joins("LEFT JOIN cost_layers ON cost_layers.variant_id = variants.id AND cost_layers.quantity_remaining > 0").
+		Where("variants.id IN ?", variantIDs).
+		Group("variants.id, variants.purchase_price").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		costs[row.VariantID] = row.AverageCost
+		if method == models.CostingMethodFIFO && row.LayerQuantity > 0 {
+			costs[row.VariantID] = row.LayerValue / row.LayerQuantity
+		}
+	}
+	return costs, nil
+}
+
+type VariantValuation struct {
+	VariantID   uuid.UUID `json:"variant_id"`
+	ProductID   uuid.UUID `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	SKU         string    `json:"sku"`
+	Quantity    float64   `json:"quantity"`
+	UnitCost    float64   `json:"unit_cost"`
+	Value       float64   `json:"value"`
+}
+
+type InventoryValuation struct {
+	CostingMethod string             `json:"costing_method"`
+	LocationID    *uuid.UUID         `json:"location_id,omitempty"`
+	TotalQuantity float64            `json:"total_quantity"`
+	TotalValue    float64            `json:"total_value"`
+	Variants      []VariantValuation `json:"variants"`
+}
+
+// GetValuation reports the value at cost of stock on hand, for the whole organization or one location
+func (s *InventoryService) GetValuation(orgID uuid.UUID, locationID *uuid.UUID) (*InventoryValuation, error) {
+	method, err := s.CostingMethod(database.DB, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	quantityColumn := "variants.quantity"
+	query := database.DB.Table("variants").
+		Joins("JOIN products ON products.id = variants.product_id").
+		Joins(`LEFT JOIN (
+			SELECT variant_id, SUM(quantity_remaining) as quantity, SUM(quantity_remaining * unit_cost) as value
+			FROM cost_layers
+			WHERE quantity_remaining > 0
+			GROUP BY variant_id
+		) layers ON layers.variant_id = variants.id`).
+		Where("products.organization_id = ?", orgID)
+
+	if locationID != nil {
+		quantityColumn = "stock_levels.quantity"
+		query = query.Joins("JOIN stock_levels ON stock_levels.variant_id = variants.id AND stock_levels.location_id = ?", *locationID)
+	}
+
+	var rows []struct {
+		VariantID     uuid.UUID
+		ProductID     uuid.UUID
+		ProductName   string
+		SKU           string
+		Quantity      float64
+		AverageCost   float64
+		LayerQuantity float64
+		LayerValue    float64
+	}
+	if err := query.
+		Select("variants.id as variant_id, products.id as product_id, products.name as product_name, variants.sku, " +
+			quantityColumn + " as quantity, variants.purchase_price as average_cost, " +
+			"COALESCE(layers.quantity, 0) as layer_quantity, COALESCE(layers.value, 0) as layer_value").
+		Where(quantityColumn + " > 0").
+		Order("products.name ASC, variants.sku ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	valuation := &InventoryValuation{
+		CostingMethod: method,
+		LocationID:    locationID,
+		Variants:      make([]VariantValuation, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		unitCost := row.AverageCost
+		if method == models.CostingMethodFIFO && row.LayerQuantity > 0 {
+			unitCost = row.LayerValue / row.LayerQuantity
+		}
+
+		value := unitCost * row.Quantity
+		valuation.TotalQuantity += row.Quantity
+		valuation.TotalValue += value
+		valuation.Variants = append(valuation.Variants, VariantValuation{
+			VariantID:   row.VariantID,
+			ProductID:   row.ProductID,
+			ProductName: row.ProductName,
+			SKU:         row.SKU,
+			Quantity:    row.Quantity,
+			UnitCost:    unitCost,
+			Value:       value,
+		})
+	}
+
+	return valuation, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bstock/models"
+	"math"
+	"testing"
+)
+
+func TestWeightedAverageCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		onHand      float64
+		currentCost float64
+		quantity    float64
+		unitCost    float64
+		want        float64
+	}{
+		{"first receipt", 0, 0, 10, 25, 25},
+		{"equal quantities", 10, 20, 10, 30, 25},
+		{"small top-up", 90, 10, 10, 20, 11},
+		{"fractional weights", 1.5, 100, 0.5, 140, 110},
+		{"negative stock takes the new cost", -4, 50, 10, 30, 30},
+		{"same cost", 7, 12, 3, 12, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := weightedAverageCost(tt.onHand, tt.currentCost, tt.quantity, tt.unitCost)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("weightedAverageCost(%v, %v, %v, %v) = %v, want %v",
+					tt.onHand, tt.currentCost, tt.quantity, tt.unitCost, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrawCostLayers(t *testing.T) {
+	tests := []struct {
+		name          string
+		remaining     []float64 // Quantity remaining in each layer, oldest first
+		costs         []float64
+		quantity      float64
+		fallbackCost  float64
+		wantCost      float64
+		wantRemaining []float64
+	}{
+		{"within the oldest layer", []float64{10, 5}, []float64{2, 3}, 4, 9, 8, []float64{6, 5}},
+		{"exactly the oldest layer", []float64{10, 5}, []float64{2, 3}, 10, 9, 20, []float64{0, 5}},
+		{"across layers", []float64{10, 5}, []float64{2, 3}, 12, 9, 26, []float64{0, 3}},
+		{"beyond all layers", []float64{10, 5}, []float64{2, 3}, 18, 9, 62, []float64{0, 0}},
+		{"no layers", nil, nil, 3, 9, 27, nil},
+		{"fractional weights", []float64{0.3, 1}, []float64{100, 200}, 0.5, 0, 70, []float64{0, 0.8}},
+		{"nothing taken", []float64{10}, []float64{2}, 0, 9, 0, []float64{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := make([]models.CostLayer, len(tt.remaining))
+			for i := range layers {
+				layers[i].QuantityRemaining = tt.remaining[i]
+				layers[i].UnitCost = tt.costs[i]
+			}
+
+			got := drawCostLayers(layers, tt.quantity, tt.fallbackCost)
+			if math.Abs(got-tt.wantCost) > 1e-9 {
+				t.Errorf("cost = %v, want %v", got, tt.wantCost)
+			}
+			for i, layer := range layers {
+				if layer.QuantityRemaining != tt.wantRemaining[i] {
+					t.Errorf("layer %d remaining = %v, want %v", i, layer.QuantityRemaining, tt.wantRemaining[i])
+				}
+			}
+		})
+	}
+}
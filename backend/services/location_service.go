@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrLocationNotFound = errors.New("location not found")
+
+const DefaultLocationName = "Main Store"
+
+type LocationService struct{}
+
+func NewLocationService() *LocationService {
+	return &LocationService{}
+}
+
+// DefaultLocation returns the organization's default location. Organizations get one when they
+// register, or from database.BackfillLocations if they predate locations.
+func (s *LocationService) DefaultLocation(tx *gorm.DB, orgID uuid.UUID) (*models.Location, error) {
+	var location models.Location
+	if err := tx.Where("organization_id = ? AND is_default = ?", orgID, true).First(&location).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLocationNotFound
+		}
+		return nil, err
+	}
+	return &location, nil
+}
+
+// GetLocation returns a location belonging to the organization
+func (s *LocationService) GetLocation(tx *gorm.DB, orgID, locationID uuid.UUID) (*models.Location, error) {
+	var location models.Location
+	if err := tx.Where("id = ? AND organization_id = ?", locationID, orgID).First(&location).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLocationNotFound
+		}
+		return nil, err
+	}
+	return &location, nil
+}
+
+// ResolveLocationID returns the given location after checking it belongs to the organization,
+// or the organization's default location when none is given
+func (s *LocationService) ResolveLocationID(tx *gorm.DB, orgID uuid.UUID, locationID *uuid.UUID) (uuid.UUID, error) {
+	if locationID != nil {
+		location, err := s.GetLocation(tx, orgID, *locationID)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return location.ID, nil
+	}
+
+	location, err := s.DefaultLocation(tx, orgID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return location.ID, nil
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bstock/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Product listing limits
+const (
+	DefaultProductPageSize = 50
+	MaxProductPageSize     = 200
+)
+
+// ErrVersionConflict is returned when a record was changed by someone else since it was read
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrInvalidCursor is returned when a listing cursor is malformed or belongs to another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// productSorts maps the sort keys accepted by List to the SQL expression rows are ordered by
+var productSorts = map[string]string{
+	"name":       "products.name",
+	"updated_at": "products.updated_at",
+	"stock": `(SELECT COALESCE(SUM(v.quantity), 0)::float8 FROM variants v
+		WHERE v.product_id = products.id AND v.status <> 'archived')`,
+}
+
+// ProductListQuery filters and pages a product listing. Variant filters match products
+// having at least one variant that satisfies all of them.
+type ProductListQuery struct {
+	OrganizationID uuid.UUID
+	Statuses       []string // Product statuses to include; empty means all
+	VariantStatus  string   // Variant status the variant filters apply to; empty means not archived
+	Category       string
+	Search         string
+	VendorID       *uuid.UUID
+	Attributes     map[string]string
+	MinPrice       *float64
+	MaxPrice       *float64
+	LowStock       bool
+	Sort           string // name, updated_at or stock
+	Descending     bool
+	Cursor         string
+	Limit          int
+}
+
+// ProductPage is one page of a product listing
+type ProductPage struct {
+	Products   []models.Product `json:"products"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Empty on the last page
+	Limit      int              `json:"limit"`
+}
+
+// productCursor is the position after the last row of a page, encoded opaquely for clients
+type productCursor struct {
+	Sort       string          `json:"s"`
+	Descending bool            `json:"d,omitempty"`
+	Value      json.RawMessage `json:"v"`
+	ID         uuid.UUID       `json:"id"`
+}
+
+type ProductService struct{}
+
+func NewProductService() *ProductService {
+	return &ProductService{}
+}
+
+// Remove hard-deletes a product none of whose variants has stock or history, and archives it otherwise.
+// It reports whether the product was archived.
+func (s *ProductService) Remove(tx *gorm.DB, product *models.Product) (bool, error) {
+	var variants []models.Variant
+	if err := tx.Where("product_id = ?", product.ID).Find(&variants).Error; err != nil {
+		return false, err
+	}
+
+	variantService := NewVariantService()
+	for i := range variants {
+		used, err := variantService.HasHistory(tx, &variants[i])
+		if err != nil {
+			return false, err
+		}
+		if used {
+			return true, s.Archive(tx, product)
+		}
+	}
+
+	variantIDs := make([]uuid.UUID, 0, len(variants))
+	for _, variant := range variants {
+		variantIDs = append(variantIDs, variant.ID)
+	}
+	if len(variantIDs) > 0 {
+		if err := tx.Where("variant_id IN ?", variantIDs).Delete(&models.CostLayer{}).Error; err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Delete(product).Error; err != nil {
+		return false, err
+	}
+
+	syncService := NewSyncService()
+	if err := syncService.RecordDeleted(tx, product.OrganizationID, models.TombstoneProduct, product.ID); err != nil {
+		return false, err
+	}
+	return false, syncService.RecordDeleted(tx, product.OrganizationID, models.TombstoneVariant, variantIDs...)
+}
+
+// Archive hides a product and all its variants from the POS while keeping them for reports
+func (s *ProductService) Archive(tx *gorm.DB, product *models.Product) error {
+	if product.Status == models.CatalogStatusArchived {
+		return nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(product).Updates(map[string]interface{}{
+		"status":      models.CatalogStatusArchived,
+		"archived_at": now,
+		"version":     gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	product.Status = models.CatalogStatusArchived
+	product.ArchivedAt = &now
+	product.Version++
+	return nil
+}
+
+// Unarchive makes an archived product active again. Its variants keep their own status.
+// The caller checks the plan's product limit first.
+func (s *ProductService) Unarchive(tx *gorm.DB, product *models.Product) error {
+	if product.Status != models.CatalogStatusArchived {
+		return nil
+	}
+
+	if err := tx.Model(product).Updates(map[string]interface{}{
+		"status":      models.CatalogStatusActive,
+		"archived_at": nil,
+		"version":     gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	product.Status = models.CatalogStatusActive
+	product.ArchivedAt = nil
+	product.Version++
+	return nil
+}
+
+// Update saves an edited product, provided nobody else saved it since it was read at version.
+// It returns ErrVersionConflict otherwise.
+func (s *ProductService) Update(tx *gorm.DB, product *models.Product, version int) error {
+	return saveVersioned(tx, product, &product.Version, version)
+}
+
+// saveVersioned writes record's columns, except omitted ones, only if its row is still at version,
+// and moves *current to the next version. Associations are not saved.
+func saveVersioned(tx *gorm.DB, record interface{}, current *int, version int, omit ...string) error {
+	*current = version + 1
+	result := tx.Model(record).
+		Where("version = ?", version).
+		Select("*").
+		Omit(append(omit, "created_at", clause.Associations)...).
+		Updates(record)
+	if result.Error != nil || result.RowsAffected == 0 {
+		*current = version
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// List returns one page of products in the requested order. Pages are keyed on the sort
+// value and product ID, so rows inserted or edited between requests don't shift later pages.
+// The scopes are applied to the final query, typically to preload associations.
+func (s *ProductService) List(tx *gorm.DB, q ProductListQuery, scopes ...func(*gorm.DB) *gorm.DB) (*ProductPage, error) {
+	if q.Sort == "" {
+		q.Sort = "name"
+	}
+	sortExpr, ok := productSorts[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultProductPageSize
+	}
+	if q.Limit > MaxProductPageSize {
+		q.Limit = MaxProductPageSize
+	}
+
+	query := tx.Model(&models.Product{}).Where("products.organization_id = ?", q.OrganizationID)
+	if len(q.Statuses) > 0 {
+		query = query.Where("products.status IN ?", q.Statuses)
+	}
+	if q.Category != "" {
+		query = query.Where("products.category = ?", q.Category)
+	}
+	if q.Search != "" {
+		query = query.Where("products.name ILIKE ?", "%"+q.Search+"%")
+	}
+	if q.VendorID != nil {
+		query = query.Where("products.vendor_id = ?", *q.VendorID)
+	}
+	if variants := variantFilter(tx, q); variants != nil {
+		query = query.Where("EXISTS (?)", variants)
+	}
+
+	page := &ProductPage{Products: []models.Product{}, Limit: q.Limit}
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		cursor, value, err := decodeProductCursor(q.Cursor, q.Sort)
+		if err != nil || cursor.Descending != q.Descending {
+			return nil, ErrInvalidCursor
+		}
+		query = query.Where(fmt.Sprintf("(%s, products.id) %s (?, ?)", sortExpr, comparison), value, cursor.ID)
+	}
+
+	rows, err := query.Select(fmt.Sprintf("products.id, %s AS sort_value", sortExpr)).
+		Order(fmt.Sprintf("sort_value %s, products.id %s", direction, direction)).
+		Limit(q.Limit + 1).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	var lastValue interface{}
+	for rows.Next() {
+		var id uuid.UUID
+		var value interface{}
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		if len(ids) == q.Limit {
+			// One row past the page means there is a next page
+			cursor, err := encodeProductCursor(productCursor{Sort: q.Sort, Descending: q.Descending, ID: ids[len(ids)-1]}, lastValue)
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = cursor
+			break
+		}
+		ids = append(ids, id)
+		lastValue = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	// Load the full rows for this page and put them back in sort order
+	var products []models.Product
+	if err := tx.Scopes(scopes...).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	for _, id := range ids {
+		if product, ok := byID[id]; ok {
+			page.Products = append(page.Products, product)
+		}
+	}
+
+	return page, nil
+}
+
+// variantFilter builds the variant subquery for the query's variant-level filters, or nil if it has none
+func variantFilter(tx *gorm.DB, q ProductListQuery) *gorm.DB {
+	if len(q.Attributes) == 0 && q.MinPrice == nil && q.MaxPrice == nil && !q.LowStock {
+		return nil
+	}
+
+	sub := tx.Session(&gorm.Session{NewDB: true}).Table("variants").Select("1").
+		Where("variants.product_id = products.id")
+	if q.VariantStatus != "" {
+		sub = sub.Where("variants.status = ?", q.VariantStatus)
+	} else {
+		sub = sub.Where("variants.status <> ?", models.CatalogStatusArchived)
+	}
+	if len(q.Attributes) > 0 {
+		attributes, _ := json.Marshal(q.Attributes)
+		sub = sub.Where("variants.attributes @> ?::jsonb", string(attributes))
+	}
+	if q.MinPrice != nil {
+		sub = sub.Where("variants.sale_price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		sub = sub.Where("variants.sale_price <= ?", *q.MaxPrice)
+	}
+	if q.LowStock {
+		sub = sub.Where("variants.quantity <= variants.min_stock_level")
+	}
+	return sub
+}
+
+func encodeProductCursor(cursor productCursor, value interface{}) (string, error) {
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC().Format(time.RFC3339Nano)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	cursor.Value = raw
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeProductCursor parses a cursor made for sort and returns it with its sort value in SQL-ready form
+func decodeProductCursor(encoded, sort string) (*productCursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cursor productCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, nil, err
+	}
+	if cursor.Sort != sort || cursor.ID == uuid.Nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	switch sort {
+	case "updated_at":
+		var value string
+		if err := json.Unmarshal(cursor.Value, &value); err != nil {
+			return nil, nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &cursor, t, nil
+	case "stock":
+		var value float64
+		if err := json.Unmarshal(cursor.Value, &value); err != nil {
+			return nil, nil, err
+		}
+		return &cursor, value, nil
+	default:
+		var value string
+		if err := json.Unmarshal(cursor.Value, &value); err != nil {
+			return nil, nil, err
+		}
+		return &cursor, value, nil
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestProductCursorRoundTrip(t *testing.T) {
+	id := uuid.MustParse("6f1c2b1e-3d4a-4b5c-8d9e-0f1a2b3c4d5e")
+	updatedAt := time.Date(2024, 3, 4, 5, 6, 7, 890123000, time.FixedZone("EAT", 3*60*60))
+
+	tests := []struct {
+		name       string
+		sort       string
+		descending bool
+		value      interface{}
+		want       interface{}
+	}{
+		{"name", "name", false, "Teff flour", "Teff flour"},
+		{"name with quotes", "name", true, `Buna "special"`, `Buna "special"`},
+		{"updated_at keeps nanoseconds in UTC", "updated_at", true, updatedAt, updatedAt.UTC()},
+		{"stock", "stock", false, 12.5, 12.5},
+		{"zero stock", "stock", true, 0.0, 0.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := encodeProductCursor(productCursor{Sort: tt.sort, Descending: tt.descending, ID: id}, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, value, err := decodeProductCursor(encoded, tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cursor.ID != id || cursor.Sort != tt.sort || cursor.Descending != tt.descending {
+				t.Errorf("cursor = %+v", cursor)
+			}
+			if got, ok := value.(time.Time); ok {
+				if want := tt.want.(time.Time); !got.Equal(want) || got.Location() != time.UTC {
+					t.Errorf("value = %v, want %v", got, want)
+				}
+			} else if value != tt.want {
+				t.Errorf("value = %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProductCursorRejects(t *testing.T) {
+	id := uuid.MustParse("6f1c2b1e-3d4a-4b5c-8d9e-0f1a2b3c4d5e")
+	nameCursor, err := encodeProductCursor(productCursor{Sort: "name", ID: id}, "Teff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nilIDCursor, err := encodeProductCursor(productCursor{Sort: "name"}, "Teff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	badTimeCursor, err := encodeProductCursor(productCursor{Sort: "updated_at", ID: id}, "yesterday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringStockCursor, err := encodeProductCursor(productCursor{Sort: "stock", ID: id}, "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		encoded     string
+		sort        string
+		wantInvalid bool // ErrInvalidCursor rather than a decoding error
+	}{
+		{"other sort", nameCursor, "stock", true},
+		{"nil id", nilIDCursor, "name", true},
+		{"not base64", "!!not-a-cursor!!", "name", false},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("teff")), "name", false},
+		{"bad time", badTimeCursor, "updated_at", false},
+		{"string stock", stringStockCursor, "stock", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeProductCursor(tt.encoded, tt.sort)
+			if err == nil {
+				t.Fatal("decodeProductCursor succeeded")
+			}
+			if tt.wantInvalid && !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
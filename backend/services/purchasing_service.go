@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPurchaseOrderStatus = errors.New("purchase order is not in a valid status for this action")
+	ErrLineNotOnOrder      = errors.New("line does not belong to this purchase order")
+)
+
+// OverReceiptError is returned when a delivery exceeds what is still outstanding on a line
+type OverReceiptError struct {
+	LineID      uuid.UUID
+	Outstanding float64
+	Received    float64
+}
+
+func (e *OverReceiptError) Error() string {
+	return fmt.Sprintf("cannot receive %g on line %s: only %g outstanding", e.Received, e.LineID, e.Outstanding)
+}
+
+type PurchasingService struct{}
+
+func NewPurchasingService() *PurchasingService {
+	return &PurchasingService{}
+}
+
+// ReceiptInput describes a delivery of goods against a purchase order
+type ReceiptInput struct {
+	UserID     uuid.UUID
+	LocationID *uuid.UUID // Defaults to the order's delivery location
+	Note       string
+	Items      []ReceiptItemInput
+}
+
+type ReceiptItemInput struct {
+	LineID   uuid.UUID
+	Quantity float64
+	Pack     string   // Pack unit the quantity and cost are given in, empty for the base unit
+	UnitCost *float64 // Defaults to the line's expected cost
+}
+
+// ReceiveGoods records a goods receipt, adds the goods to stock and updates each variant's cost.
+// The order must be loaded with Lines and locked; the caller owns the transaction.
+func (s *PurchasingService) ReceiveGoods(tx *gorm.DB, order *models.PurchaseOrder, input ReceiptInput) (*models.GoodsReceipt, error) {
+	if order.Status != models.PurchaseOrderStatusOrdered && order.Status != models.PurchaseOrderStatusPartiallyReceived {
+		return nil, ErrPurchaseOrderStatus
+	}
+
+	locationID := order.LocationID
+	if input.LocationID != nil {
+		locationID = *input.LocationID
+	}
+
+	lines := make(map[uuid.UUID]*models.PurchaseOrderLine, len(order.Lines))
+	for i := range order.Lines {
+		lines[order.Lines[i].ID] = &order.Lines[i]
+	}
+
+	receipt := models.GoodsReceipt{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  order.OrganizationID,
+		PurchaseOrderID: order.ID,
+		LocationID:      locationID,
+		ReceivedBy:      input.UserID,
+		Note:            input.Note,
+	}
+
+	inventoryService := NewInventoryService()
+	for _, itemInput := range input.Items {
+		line, ok := lines[itemInput.LineID]
+		if !ok {
+			return nil, ErrLineNotOnOrder
+		}
+
+		quantity := itemInput.Quantity
+		unitCost := line.UnitCost
+		if itemInput.UnitCost != nil {
+			unitCost = *itemInput.UnitCost
+		}
+		if itemInput.Pack != "" {
+			pack, err := inventoryService.FindPack(tx, line.VariantID, itemInput.Pack)
+			if err != nil {
+				return nil, err
+			}
+			quantity = pack.BaseQuantity(quantity)
+			if itemInput.UnitCost != nil {
+				unitCost = pack.BaseUnitCost(unitCost)
+			}
+		}
+
+		outstanding := models.RoundQuantity(line.Quantity - line.QuantityReceived)
+		if quantity > outstanding {
+			return nil, &OverReceiptError{LineID: line.ID, Outstanding: outstanding, Received: quantity}
+		}
+
+		variant, err := inventoryService.LockVariant(tx, order.OrganizationID, line.VariantID)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+			OrganizationID: order.OrganizationID,
+			LocationID:     &locationID,
+			UserID:         input.UserID,
+			Delta:          quantity,
+			ReasonCode:     models.MovementReasonRestock,
+			SourceType:     models.MovementSourceReceipt,
+			SourceID:       &receipt.ID,
+			Note:           input.Note,
+			UnitCost:       &unitCost,
+		}); err != nil {
+			return nil, err
+		}
+
+		line.QuantityReceived = models.RoundQuantity(line.QuantityReceived + quantity)
+		if err := tx.Model(line).Update("quantity_received", line.QuantityReceived).Error; err != nil {
+			return nil, err
+		}
+
+		receipt.TotalCost += unitCost * quantity
+		receipt.Items = append(receipt.Items, models.GoodsReceiptItem{
+			PurchaseOrderLineID: line.ID,
+			VariantID:           line.VariantID,
+			Quantity:            quantity,
+			UnitCost:            unitCost,
+		})
+	}
+
+	if err := tx.Create(&receipt).Error; err != nil {
+		return nil, err
+	}
+
+	order.Status = models.PurchaseOrderStatusReceived
+	for _, line := range order.Lines {
+		if line.QuantityReceived < line.Quantity {
+			order.Status = models.PurchaseOrderStatusPartiallyReceived
+			break
+		}
+	}
+	if err := tx.Model(order).Update("status", order.Status).Error; err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
@@ -31,8 +31,8 @@ func (s *ReceiptService) GenerateReceipt(sale *models.Sale, org *models.Organiza
 		if item.Variant.Product.Name != "" {
 			productName = item.Variant.Product.Name
 		}
-		buf.WriteString(fmt.Sprintf("%dx %s\n", item.Quantity, productName))
-		buf.WriteString(fmt.Sprintf("   @ %.2f = %.2f\n", item.PriceAtSale, float64(item.Quantity)*item.PriceAtSale))
+		buf.WriteString(fmt.Sprintf("%gx %s\n", item.Quantity, productName))
+		buf.WriteString(fmt.Sprintf("   @ %.2f = %.2f\n", item.PriceAtSale, item.Quantity*item.PriceAtSale))
 	}
 
 	buf.WriteString("\n-------------------------------\n")
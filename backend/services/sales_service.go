@@ -0,0 +1,468 @@
+package services
+
+import (
+	"bstock/models"
+	"bstock/storage"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VariantNotFoundError is returned when a sale line references a variant outside the organization
+type VariantNotFoundError struct {
+	VariantID uuid.UUID
+}
+
+func (e *VariantNotFoundError) Error() string {
+	return fmt.Sprintf("variant not found: %s", e.VariantID)
+}
+
+// InsufficientStockError is returned when a sale line exceeds the variant's stock on hand
+type InsufficientStockError struct {
+	VariantID uuid.UUID
+	Available float64
+	Requested float64
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for variant %s: available %g, requested %g", e.VariantID, e.Available, e.Requested)
+}
+
+type SalesService struct{}
+
+func NewSalesService() *SalesService {
+	return &SalesService{}
+}
+
+// SaleInput describes a sale to be recorded, either live from the POS or replayed from a device
+type SaleInput struct {
+	OrganizationID uuid.UUID
+	UserID         uuid.UUID
+	LocationID     *uuid.UUID // Location selling the goods, defaults to the organization's default location
+	PaymentMethod  string
+	Items          []SaleItemInput
+	ClientSaleID   *uuid.UUID // Set for sales generated on a device, used for idempotent sync
+	SoldAt         *time.Time // Original device timestamp, defaults to now
+	OversellPolicy string     // How to handle lines exceeding stock, defaults to reject
+}
+
+type SaleItemInput struct {
+	VariantID  uuid.UUID
+	Quantity   float64
+	Pack       string   // Pack unit the quantity is counted in, empty for the base unit
+	LineAmount *float64 // Fixed line total, e.g. from a price-embedded scale barcode; defaults to quantity times sale price
+}
+
+// FindByClientSaleID returns the sale previously recorded for a device-generated sale ID
+func (s *SalesService) FindByClientSaleID(tx *gorm.DB, orgID, clientSaleID uuid.UUID) (*models.Sale, error) {
+	var sale models.Sale
+	if err := tx.Where("organization_id = ? AND client_sale_id = ?", orgID, clientSaleID).
+		First(&sale).Error; err != nil {
+		return nil, err
+	}
+	return &sale, nil
+}
+
+// CreateSale records a sale with its items and decrements inventory inside tx.
+// The caller owns the transaction and must roll back on error.
+func (s *SalesService) CreateSale(tx *gorm.DB, input SaleInput) (*models.Sale, error) {
+	// Assign the sale ID up front so stock movements can reference it
+	saleID := uuid.New()
+	inventoryService := NewInventoryService()
+
+	locationID, err := NewLocationService().ResolveLocationID(tx, input.OrganizationID, input.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalAmount float64
+	var totalProfit float64
+	var saleItems []models.SaleItem
+	var conflicts []models.StockConflict
+
+	// Process each item
+	for _, item := range input.Items {
+		// Lock variant row for update
+		variant, err := inventoryService.LockVariant(tx, input.OrganizationID, item.VariantID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, &VariantNotFoundError{VariantID: item.VariantID}
+			}
+			return nil, err
+		}
+
+		// Only active products and variants sell live; sales recorded offline before a change are still accepted
+		if input.ClientSaleID == nil {
+			status := variant.Status
+			if status == models.CatalogStatusActive {
+				if err := tx.Model(&models.Product{}).Where("id = ?", variant.ProductID).Pluck("status", &status).Error; err != nil {
+					return nil, err
+				}
+			}
+			if status != models.CatalogStatusActive {
+				return nil, &VariantUnavailableError{VariantID: variant.ID, Status: status}
+			}
+		}
+
+		// Packs are sold as their base units, at the pack price when one is set
+		if item.Pack != "" {
+			pack, err := inventoryService.FindPack(tx, variant.ID, item.Pack)
+			if err != nil {
+				return nil, err
+			}
+			if pack.SalePrice != nil && item.LineAmount == nil {
+				lineAmount := *pack.SalePrice * item.Quantity
+				item.LineAmount = &lineAmount
+			}
+			item.Quantity = pack.BaseQuantity(item.Quantity)
+		}
+
+		// Check stock availability at the selling location
+		level, err := inventoryService.LockStockLevel(tx, variant.ID, locationID)
+		if err != nil {
+			return nil, err
+		}
+
+		oversold := level.Quantity < item.Quantity
+		if oversold {
+			switch input.OversellPolicy {
+			case models.OversellPolicyAllowNegative:
+				// Accept the sale and let the balance go negative
+			case models.OversellPolicyFlagConflict:
+				available := level.Quantity
+				if available < 0 {
+					available = 0
+				}
+				conflicts = append(conflicts, models.StockConflict{
+					OrganizationID: input.OrganizationID,
+					SaleID:         saleID,
+					VariantID:      item.VariantID,
+					LocationID:     &locationID,
+					Requested:      item.Quantity,
+					Available:      available,
+					Shortfall:      models.RoundQuantity(item.Quantity - available),
+					Status:         models.ConflictStatusOpen,
+				})
+			default:
+				return nil, &InsufficientStockError{
+					VariantID: item.VariantID,
+					Available: level.Quantity,
+					Requested: item.Quantity,
+				}
+			}
+		}
+
+		// Decrement stock, valuing the goods by the organization's costing method
+		movement, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+			OrganizationID: input.OrganizationID,
+			LocationID:     &locationID,
+			UserID:         input.UserID,
+			Delta:          -item.Quantity,
+			ReasonCode:     models.MovementReasonSale,
+			SourceType:     models.MovementSourceSale,
+			SourceID:       &saleID,
+			AllowNegative:  oversold,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Calculate amounts
+		itemTotal := variant.SalePrice * item.Quantity
+		priceAtSale := variant.SalePrice
+		if item.LineAmount != nil {
+			itemTotal = *item.LineAmount
+			priceAtSale = itemTotal / item.Quantity
+		}
+		itemCost := movement.UnitCost * item.Quantity
+		itemProfit := itemTotal - itemCost
+
+		totalAmount += itemTotal
+		totalProfit += itemProfit
+
+		// Prepare sale item
+		saleItems = append(saleItems, models.SaleItem{
+			VariantID:           item.VariantID,
+			Quantity:            item.Quantity,
+			PriceAtSale:         priceAtSale,
+			PurchasePriceAtSale: movement.UnitCost,
+		})
+	}
+
+	// Create sale record
+	sale := models.Sale{
+		BaseModel:      models.BaseModel{ID: saleID},
+		OrganizationID: input.OrganizationID,
+		UserID:         input.UserID,
+		LocationID:     &locationID,
+		TotalAmount:    totalAmount,
+		TotalProfit:    totalProfit,
+		PaymentMethod:  input.PaymentMethod,
+		ClientSaleID:   input.ClientSaleID,
+	}
+
+	if input.SoldAt != nil {
+		sale.CreatedAt = *input.SoldAt
+	}
+	if input.ClientSaleID != nil {
+		syncedAt := time.Now()
+		sale.IsSynced = true
+		sale.SyncedAt = &syncedAt
+	}
+
+	if err := tx.Create(&sale).Error; err != nil {
+		return nil, err
+	}
+
+	// Create sale items
+	for i := range saleItems {
+		saleItems[i].SaleID = sale.ID
+		if err := tx.Create(&saleItems[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Flag oversold lines for the owner to resolve
+	for i := range conflicts {
+		if err := tx.Create(&conflicts[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	sale.Items = saleItems
+	sale.Conflicts = conflicts
+	return &sale, nil
+}
+
+// ReturnQuantityError is returned when a return exceeds what is left to return on a sale line
+type ReturnQuantityError struct {
+	SaleItemID uuid.UUID
+	Returnable float64
+	Requested  float64
+}
+
+func (e *ReturnQuantityError) Error() string {
+	return fmt.Sprintf("cannot return %g of sale item %s: only %g returnable", e.Requested, e.SaleItemID, e.Returnable)
+}
+
+var (
+	ErrSaleItemNotInSale   = errors.New("sale item does not belong to sale")
+	ErrNothingToReturn     = errors.New("nothing left to return on this sale")
+	ErrRefundExceedsReturn = errors.New("refund amount exceeds value of returned goods")
+)
+
+// ReturnInput describes goods handed back against a sale.
+// An empty Items list returns everything still outstanding on the sale.
+type ReturnInput struct {
+	OrganizationID uuid.UUID
+	UserID         uuid.UUID
+	Sale           *models.Sale // Must be loaded with Items and locked in the transaction
+	Items          []ReturnItemInput
+	Damaged        bool     // Default disposition for a full return
+	RefundMethod   string   // Defaults to the sale's payment method
+	RefundAmount   *float64 // Defaults to the value of the returned goods at sale price
+	Reason         string
+}
+
+type ReturnItemInput struct {
+	SaleItemID uuid.UUID
+	Quantity   float64
+	Damaged    bool // Write the goods off instead of restocking them
+}
+
+// CreateReturn records a return, restocks or writes off the goods, and reverses the matching revenue and profit.
+// The caller owns the transaction and must roll back on error.
+func (s *SalesService) CreateReturn(tx *gorm.DB, input ReturnInput) (*models.SaleReturn, error) {
+	sale := input.Sale
+
+	// Quantities already returned per sale line
+	var returned []struct {
+		SaleItemID uuid.UUID
+		Quantity   float64
+	}
+	if err := tx.Model(&models.SaleReturnItem{}).
+		Joins("JOIN sale_returns ON sale_returns.id = sale_return_items.sale_return_id").
+		Where("sale_returns.sale_id = ?", sale.ID).
+		Select("sale_return_items.sale_item_id, SUM(sale_return_items.quantity) as quantity").
+		Group("sale_return_items.sale_item_id").
+		Scan(&returned).Error; err != nil {
+		return nil, err
+	}
+
+	returnable := make(map[uuid.UUID]float64, len(sale.Items))
+	saleItems := make(map[uuid.UUID]models.SaleItem, len(sale.Items))
+	for _, item := range sale.Items {
+		returnable[item.ID] = item.Quantity
+		saleItems[item.ID] = item
+	}
+	for _, r := range returned {
+		returnable[r.SaleItemID] = models.RoundQuantity(returnable[r.SaleItemID] - r.Quantity)
+	}
+
+	items := input.Items
+	if len(items) == 0 {
+		for _, item := range sale.Items {
+			if returnable[item.ID] > 0 {
+				items = append(items, ReturnItemInput{
+					SaleItemID: item.ID,
+					Quantity:   returnable[item.ID],
+					Damaged:    input.Damaged,
+				})
+			}
+		}
+		if len(items) == 0 {
+			return nil, ErrNothingToReturn
+		}
+	}
+
+	saleReturn := models.SaleReturn{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: input.OrganizationID,
+		SaleID:         sale.ID,
+		UserID:         input.UserID,
+		RefundMethod:   input.RefundMethod,
+		Reason:         input.Reason,
+	}
+	if saleReturn.RefundMethod == "" {
+		saleReturn.RefundMethod = sale.PaymentMethod
+	}
+
+	inventoryService := NewInventoryService()
+	var goodsValue float64
+	var profitReversed float64
+
+	for _, itemInput := range items {
+		saleItem, ok := saleItems[itemInput.SaleItemID]
+		if !ok {
+			return nil, ErrSaleItemNotInSale
+		}
+		if itemInput.Quantity > returnable[saleItem.ID] {
+			return nil, &ReturnQuantityError{
+				SaleItemID: saleItem.ID,
+				Returnable: returnable[saleItem.ID],
+				Requested:  itemInput.Quantity,
+			}
+		}
+		returnable[saleItem.ID] = models.RoundQuantity(returnable[saleItem.ID] - itemInput.Quantity)
+
+		refund := saleItem.PriceAtSale * itemInput.Quantity
+		cost := saleItem.PurchasePriceAtSale * itemInput.Quantity
+		goodsValue += refund
+
+		// Restocked goods give back only their margin; written-off goods also lose their cost
+		if itemInput.Damaged {
+			profitReversed += refund
+		} else {
+			profitReversed += refund - cost
+		}
+
+		variant, err := inventoryService.LockVariant(tx, input.OrganizationID, saleItem.VariantID)
+		if err != nil {
+			return nil, err
+		}
+		if !models.ValidQuantity(itemInput.Quantity, variant.UnitType) {
+			return nil, &QuantityPrecisionError{VariantID: variant.ID, UnitType: variant.UnitType, Quantity: itemInput.Quantity}
+		}
+
+		// Damaged goods never go back on the shelf. Restocking them and writing them off again would
+		// draw the write-off from the oldest cost layers and shift the average cost, so they are only
+		// recorded on the return line at their cost of sale.
+		if !itemInput.Damaged {
+			if _, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+				OrganizationID: input.OrganizationID,
+				LocationID:     sale.LocationID,
+				UserID:         input.UserID,
+				Delta:          itemInput.Quantity,
+				ReasonCode:     models.MovementReasonReturn,
+				SourceType:     models.MovementSourceReturn,
+				SourceID:       &saleReturn.ID,
+				Note:           input.Reason,
+				AllowNegative:  true,
+				UnitCost:       &saleItem.PurchasePriceAtSale,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		saleReturn.Items = append(saleReturn.Items, models.SaleReturnItem{
+			SaleItemID:   saleItem.ID,
+			VariantID:    saleItem.VariantID,
+			Quantity:     itemInput.Quantity,
+			Damaged:      itemInput.Damaged,
+			RefundAmount: refund,
+			CostAmount:   cost,
+		})
+	}
+
+	// A negotiated refund below the goods value keeps the difference as profit
+	saleReturn.RefundAmount = goodsValue
+	if input.RefundAmount != nil {
+		if *input.RefundAmount > goodsValue {
+			return nil, ErrRefundExceedsReturn
+		}
+		profitReversed -= goodsValue - *input.RefundAmount
+		saleReturn.RefundAmount = *input.RefundAmount
+	}
+	saleReturn.ProfitReversed = profitReversed
+
+	if err := tx.Create(&saleReturn).Error; err != nil {
+		return nil, err
+	}
+
+	return &saleReturn, nil
+}
+
+const MaxPaymentProofSize = 10 << 20
+
+var (
+	ErrPaymentProofTooLarge    = errors.New("payment proof exceeds the maximum upload size")
+	ErrUnsupportedPaymentProof = errors.New("payment proof must be a JPEG, PNG or PDF")
+)
+
+// paymentProofExtensions maps accepted proof content types, sniffed from the data
+var paymentProofExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// AttachPaymentProof stores a proof of payment under the sale's organization and replaces any previous one.
+// The stored name is derived from the client's file name but its extension always matches the sniffed content.
+func (s *SalesService) AttachPaymentProof(tx *gorm.DB, sale *models.Sale, filename string, data []byte) error {
+	if len(data) > MaxPaymentProofSize {
+		return ErrPaymentProofTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := paymentProofExtensions[contentType]
+	if !ok {
+		return ErrUnsupportedPaymentProof
+	}
+
+	name := storage.SanitizeFilename(filename)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	key := fmt.Sprintf("orgs/%s/sales/%s/%s-%s%s", sale.OrganizationID, sale.ID, uuid.NewString()[:8], name, extension)
+
+	if err := storage.Default.Put(key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return err
+	}
+
+	previous := sale.PaymentProofKey
+	if err := tx.Model(sale).Update("payment_proof_key", key).Error; err != nil {
+		storage.Default.Delete(key)
+		return err
+	}
+	sale.PaymentProofKey = key
+
+	if previous != "" {
+		storage.Default.Delete(previous)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bstock/models"
+	"bstock/utils"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// searchWordSimilarity is how closely a query word must match a word in a field; pg_trgm's
+// default of 0.6 misses common one-letter typos in short product names
+const searchWordSimilarity = "0.4"
+
+// SearchHit is a variant matching a search, with its product
+type SearchHit struct {
+	Variant   models.Variant `json:"variant"`
+	Score     float64        `json:"score"`      // 0 to 1, higher is better
+	MatchedOn string         `json:"matched_on"` // barcode, sku, name, variant or details
+}
+
+type SearchService struct{}
+
+func NewSearchService() *SearchService {
+	return &SearchService{}
+}
+
+// searchQuery scores each active variant of the organization's active products by its best
+// matching field. Exact barcode and SKU matches outrank fuzzy name matches, which outrank
+// matches on variant attributes and then on category and description.
+const searchQuery = `
+SELECT v.id, best.score, best.field
+FROM variants v
+JOIN products p ON p.id = v.product_id
+CROSS JOIN LATERAL (
+	SELECT s.field, s.score FROM (VALUES
+		('barcode', CASE
+			WHEN EXISTS (SELECT 1 FROM barcodes b WHERE b.variant_id = v.id AND b.code = @code) THEN 1.0
+			WHEN EXISTS (SELECT 1 FROM barcodes b WHERE b.variant_id = v.id AND b.code LIKE @code_prefix) THEN 0.85
+			ELSE 0 END),
+		('sku', CASE
+			WHEN lower(v.sku) = @sku THEN 1.0
+			WHEN lower(v.sku) LIKE @sku_prefix THEN 0.9
+			ELSE 0 END),
+		('name', GREATEST(similarity(p.search_name, @term), word_similarity(@term, p.search_name) * 0.95)),
+		('variant', word_similarity(@term, v.search_text) * 0.8),
+		('details', word_similarity(@term, p.search_text) * 0.6)
+	) AS s(field, score)
+	ORDER BY s.score DESC
+	LIMIT 1
+) best
+WHERE p.organization_id = @org
+  AND p.status = 'active'
+  AND v.status = 'active'
+  AND (
+	p.search_name % @term OR @term <% p.search_name OR p.search_name LIKE @contains
+	OR @term <% v.search_text OR v.search_text LIKE @contains
+	OR @term <% p.search_text OR p.search_text LIKE @contains
+	OR lower(v.sku) LIKE @sku_prefix
+	OR EXISTS (SELECT 1 FROM barcodes b WHERE b.variant_id = v.id AND b.code LIKE @code_prefix)
+  )
+ORDER BY best.score DESC, p.name, v.position
+LIMIT @limit`
+
+// Search finds sellable variants matching query across product name, category and description,
+// variant SKU and attributes, and barcodes. It tolerates typos, and Ethiopic-script queries
+// also match products whose names were typed in Latin transliteration and vice versa.
+func (s *SearchService) Search(tx *gorm.DB, orgID uuid.UUID, query string, limit int) ([]SearchHit, error) {
+	code := strings.TrimSpace(query)
+	term := utils.TransliterateEthiopic(utils.NormalizeSearch(query))
+	hits := []SearchHit{}
+	if code == "" {
+		return hits, nil
+	}
+	if term == "" {
+		// Punctuation-only queries can still match SKUs and barcodes literally
+		term = strings.ToLower(code)
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	type match struct {
+		ID    uuid.UUID
+		Score float64
+		Field string
+	}
+	var matches []match
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// SET can't take bind parameters; set_config(..., true) is its transaction-local equivalent
+		if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", searchWordSimilarity).Error; err != nil {
+			return err
+		}
+		return tx.Raw(searchQuery, map[string]interface{}{
+			"org":         orgID,
+			"term":        term,
+			"contains":    "%" + escapeLike(term) + "%",
+			"sku":         strings.ToLower(code),
+			"sku_prefix":  escapeLike(strings.ToLower(code)) + "%",
+			"code":        code,
+			"code_prefix": escapeLike(code) + "%",
+			"limit":       limit,
+		}).Scan(&matches).Error
+	})
+	if err != nil || len(matches) == 0 {
+		return hits, err
+	}
+
+	ids := make([]uuid.UUID, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	var variants []models.Variant
+	if err := tx.Where("id IN ?", ids).
+		Preload("Product").
+		Preload("Product.Images", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Preload("Barcodes").
+		Preload("Packs").
+		Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Variant, len(variants))
+	for _, variant := range variants {
+		byID[variant.ID] = variant
+	}
+
+	for _, m := range matches {
+		if variant, ok := byID[m.ID]; ok {
+			hits = append(hits, SearchHit{Variant: variant, Score: m.Score, MatchedOn: m.Field})
+		}
+	}
+	return hits, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStocktakeStatus     = errors.New("stocktake is not open")
+	ErrVariantNotInScope   = errors.New("variant is not part of this stocktake")
+	ErrEmptyStocktakeScope = errors.New("no variants in stocktake scope")
+)
+
+// StocktakeCount is a counted quantity for one variant submitted by a device
+type StocktakeCount struct {
+	VariantID uuid.UUID
+	Quantity  float64
+}
+
+// StocktakeVarianceLine compares a counted quantity against the system quantity at the location
+type StocktakeVarianceLine struct {
+	VariantID       uuid.UUID `json:"variant_id"`
+	ProductName     string    `json:"product_name"`
+	SKU             string    `json:"sku"`
+	CountedQuantity *float64  `json:"counted_quantity"`
+	SystemQuantity  float64   `json:"system_quantity"`
+	Variance        float64   `json:"variance"`
+	UnitCost        float64   `json:"unit_cost"`
+	VarianceValue   float64   `json:"variance_value"`
+}
+
+// StocktakeVariance summarises a stocktake. Shrinkage is stock missing against the system, valued at cost.
+type StocktakeVariance struct {
+	StocktakeID       uuid.UUID               `json:"stocktake_id"`
+	Status            string                  `json:"status"`
+	ItemsInScope      int                     `json:"items_in_scope"`
+	ItemsCounted      int                     `json:"items_counted"`
+	ShrinkageQuantity float64                 `json:"shrinkage_quantity"`
+	ShrinkageValue    float64                 `json:"shrinkage_value"`
+	SurplusQuantity   float64                 `json:"surplus_quantity"`
+	SurplusValue      float64                 `json:"surplus_value"`
+	NetVarianceValue  float64                 `json:"net_variance_value"`
+	Lines             []StocktakeVarianceLine `json:"lines"`
+}
+
+type StocktakeService struct{}
+
+func NewStocktakeService() *StocktakeService {
+	return &StocktakeService{}
+}
+
+// Open starts a stocktake and adds every variant in scope at the location as an uncounted item.
+// Archived variants and products are left out so committing never posts movements against them.
+func (s *StocktakeService) Open(tx *gorm.DB, stocktake *models.Stocktake) error {
+	query := tx.Model(&models.Variant{}).
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ?", stocktake.OrganizationID).
+		Where("variants.status <> ? AND products.status <> ?", models.CatalogStatusArchived, models.CatalogStatusArchived)
+	if stocktake.Category != "" {
+		query = query.Where("products.category = ?", stocktake.Category)
+	}
+
+	var variantIDs []uuid.UUID
+	if err := query.Order("products.name ASC, variants.sku ASC").Pluck("variants.id", &variantIDs).Error; err != nil {
+		return err
+	}
+	if len(variantIDs) == 0 {
+		return ErrEmptyStocktakeScope
+	}
+
+	stocktake.Status = models.StocktakeStatusOpen
+	stocktake.Items = make([]models.StocktakeItem, 0, len(variantIDs))
+	for _, variantID := range variantIDs {
+		stocktake.Items = append(stocktake.Items, models.StocktakeItem{VariantID: variantID})
+	}
+
+	return tx.Create(stocktake).Error
+}
+
+// RecordCounts stores counted quantities. With add set, counts are added to what other devices
+// already submitted, so separate shelves of the same variant can be counted in parallel.
+// The stocktake must be locked and loaded with Items; the caller owns the transaction.
+func (s *StocktakeService) RecordCounts(tx *gorm.DB, stocktake *models.Stocktake, userID uuid.UUID, counts []StocktakeCount, add bool) error {
+	if stocktake.Status != models.StocktakeStatusOpen {
+		return ErrStocktakeStatus
+	}
+
+	items := make(map[uuid.UUID]*models.StocktakeItem, len(stocktake.Items))
+	for i := range stocktake.Items {
+		items[stocktake.Items[i].VariantID] = &stocktake.Items[i]
+	}
+
+	now := time.Now()
+	for _, count := range counts {
+		item, ok := items[count.VariantID]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrVariantNotInScope, count.VariantID)
+		}
+
+		quantity := count.Quantity
+		if add && item.CountedQuantity != nil {
+			quantity = models.RoundQuantity(quantity + *item.CountedQuantity)
+		}
+
+		item.CountedQuantity = &quantity
+		item.CountedBy = &userID
+		item.CountedAt = &now
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"counted_quantity": quantity,
+			"counted_by":       userID,
+			"counted_at":       now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Variance reports counted against system quantities. Open stocktakes are compared with the live
+// balance at the location and current costs; committed ones report what was posted.
+// The stocktake must be loaded with Items.Variant.Product.
+func (s *StocktakeService) Variance(tx *gorm.DB, stocktake *models.Stocktake) (*StocktakeVariance, error) {
+	var balances map[uuid.UUID]float64
+	var costs map[uuid.UUID]float64
+
+	if stocktake.Status == models.StocktakeStatusOpen {
+		variantIDs := make([]uuid.UUID, 0, len(stocktake.Items))
+		for _, item := range stocktake.Items {
+			variantIDs = append(variantIDs, item.VariantID)
+		}
+
+		var levels []models.StockLevel
+		if err := tx.Where("location_id = ? AND variant_id IN ?", stocktake.LocationID, variantIDs).
+			Find(&levels).Error; err != nil {
+			return nil, err
+		}
+		balances = make(map[uuid.UUID]float64, len(levels))
+		for _, level := range levels {
+			balances[level.VariantID] = level.Quantity
+		}
+
+		var err error
+		if costs, err = NewInventoryService().UnitCosts(tx, stocktake.OrganizationID, variantIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &StocktakeVariance{
+		StocktakeID:  stocktake.ID,
+		Status:       stocktake.Status,
+		ItemsInScope: len(stocktake.Items),
+		Lines:        make([]StocktakeVarianceLine, 0, len(stocktake.Items)),
+	}
+
+	for _, item := range stocktake.Items {
+		line := StocktakeVarianceLine{
+			VariantID:       item.VariantID,
+			ProductName:     item.Variant.Product.Name,
+			SKU:             item.Variant.SKU,
+			CountedQuantity: item.CountedQuantity,
+		}
+
+		if stocktake.Status == models.StocktakeStatusOpen {
+			line.SystemQuantity = balances[item.VariantID]
+			line.UnitCost = costs[item.VariantID]
+			if item.CountedQuantity != nil {
+				line.Variance = models.RoundQuantity(*item.CountedQuantity - line.SystemQuantity)
+			}
+			line.VarianceValue = line.Variance * line.UnitCost
+		} else {
+			if item.SystemQuantity != nil {
+				line.SystemQuantity = *item.SystemQuantity
+			}
+			line.Variance = item.Variance
+			line.UnitCost = item.UnitCost
+			line.VarianceValue = item.VarianceValue
+		}
+
+		if item.CountedQuantity != nil {
+			report.ItemsCounted++
+		}
+		if line.Variance < 0 {
+			report.ShrinkageQuantity -= line.Variance
+			report.ShrinkageValue -= line.VarianceValue
+		} else if line.Variance > 0 {
+			report.SurplusQuantity += line.Variance
+			report.SurplusValue += line.VarianceValue
+		}
+		report.NetVarianceValue += line.VarianceValue
+
+		report.Lines = append(report.Lines, line)
+	}
+
+	return report, nil
+}
+
+// Commit posts every variance as a stock adjustment at the stocktake's location, so balances match the count.
+// Uncounted items are left as they are unless zeroUncounted is set, in which case they are counted as zero.
+// The stocktake must be locked and loaded with Items; the caller owns the transaction.
+func (s *StocktakeService) Commit(tx *gorm.DB, stocktake *models.Stocktake, userID uuid.UUID, zeroUncounted bool) error {
+	if stocktake.Status != models.StocktakeStatusOpen {
+		return ErrStocktakeStatus
+	}
+
+	inventoryService := NewInventoryService()
+	variantIDs := make([]uuid.UUID, 0, len(stocktake.Items))
+	for _, item := range stocktake.Items {
+		variantIDs = append(variantIDs, item.VariantID)
+	}
+	costs, err := inventoryService.UnitCosts(tx, stocktake.OrganizationID, variantIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range stocktake.Items {
+		item := &stocktake.Items[i]
+
+		if item.CountedQuantity == nil {
+			if !zeroUncounted {
+				continue
+			}
+			zero := 0.0
+			item.CountedQuantity = &zero
+		}
+
+		variant, err := inventoryService.LockVariant(tx, stocktake.OrganizationID, item.VariantID)
+		if err != nil {
+			return err
+		}
+		level, err := inventoryService.LockStockLevel(tx, variant.ID, stocktake.LocationID)
+		if err != nil {
+			return err
+		}
+
+		systemQuantity := level.Quantity
+		item.SystemQuantity = &systemQuantity
+		item.Variance = models.RoundQuantity(*item.CountedQuantity - systemQuantity)
+		item.UnitCost = costs[item.VariantID]
+
+		if item.Variance != 0 {
+			movement, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+				OrganizationID: stocktake.OrganizationID,
+				LocationID:     &stocktake.LocationID,
+				UserID:         userID,
+				Delta:          item.Variance,
+				ReasonCode:     models.MovementReasonCorrection,
+				SourceType:     models.MovementSourceStocktake,
+				SourceID:       &stocktake.ID,
+				UnitCost:       &item.UnitCost,
+			})
+			if err != nil {
+				return err
+			}
+			item.UnitCost = movement.UnitCost
+		}
+		item.VarianceValue = item.Variance * item.UnitCost
+
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"counted_quantity": *item.CountedQuantity,
+			"system_quantity":  systemQuantity,
+			"variance":         item.Variance,
+			"unit_cost":        item.UnitCost,
+			"variance_value":   item.VarianceValue,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	stocktake.Status = models.StocktakeStatusCommitted
+	stocktake.CommittedBy = &userID
+	stocktake.CommittedAt = &now
+	return tx.Model(stocktake).Updates(map[string]interface{}{
+		"status":       stocktake.Status,
+		"committed_by": stocktake.CommittedBy,
+		"committed_at": stocktake.CommittedAt,
+	}).Error
+}
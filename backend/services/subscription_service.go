@@ -28,7 +28,7 @@ func (s *SubscriptionService) GetOrganizationPlan(orgID uuid.UUID) (*models.Plan
 	return &org.Subscription.Plan, nil
 }
 
-// CanAddProduct checks if organization can add more products
+// CanAddProduct checks if organization can add more active products
 func (s *SubscriptionService) CanAddProduct(orgID uuid.UUID) (bool, error) {
 	plan, err := s.GetOrganizationPlan(orgID)
 	if err != nil {
@@ -41,7 +41,7 @@ func (s *SubscriptionService) CanAddProduct(orgID uuid.UUID) (bool, error) {
 
 	var count int64
 	if err := database.DB.Model(&models.Product{}).
-		Where("organization_id = ?", orgID).
+		Where("organization_id = ? AND status = ?", orgID, models.CatalogStatusActive).
 		Count(&count).Error; err != nil {
 		return false, err
 	}
@@ -49,6 +49,31 @@ func (s *SubscriptionService) CanAddProduct(orgID uuid.UUID) (bool, error) {
 	return count < int64(*plan.ProductLimit), nil
 }
 
+// RemainingProducts returns how many more active products the plan allows, or nil when unlimited
+func (s *SubscriptionService) RemainingProducts(orgID uuid.UUID) (*int64, error) {
+	plan, err := s.GetOrganizationPlan(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.ProductLimit == nil {
+		return nil, nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Product{}).
+		Where("organization_id = ? AND status = ?", orgID, models.CatalogStatusActive).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	remaining := int64(*plan.ProductLimit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining, nil
+}
+
 // CanAddUser checks if organization can add more users
 func (s *SubscriptionService) CanAddUser(orgID uuid.UUID) (bool, error) {
 	plan, err := s.GetOrganizationPlan(orgID)
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// SyncOverlap re-sends changes made shortly before the cursor, so rows written by transactions
+	// that committed after the previous sync started are not missed. Devices apply changes idempotently.
+	SyncOverlap = 2 * time.Minute
+	// TombstoneRetention is how long deletions are remembered. Older cursors get the full catalog.
+	TombstoneRetention = 30 * 24 * time.Hour
+)
+
+// Reasons a device is told to drop a record
+const (
+	SyncRemovedDeleted  = "deleted"
+	SyncRemovedArchived = "archived"
+	SyncRemovedDraft    = "draft"
+)
+
+var ErrInvalidSyncCursor = errors.New("invalid sync cursor")
+
+// SyncTombstone tells a device to drop a record. Dropping a product drops its variants and
+// their stock levels with it.
+type SyncTombstone struct {
+	Type   string    `json:"type"` // product, variant, stock_level or vendor
+	ID     uuid.UUID `json:"id"`
+	Reason string    `json:"reason"` // deleted, archived or draft
+	At     time.Time `json:"at"`
+}
+
+// CatalogChanges is what a device needs to bring its offline catalog up to date.
+// Only active products and variants are sent; others are reported as tombstones.
+type CatalogChanges struct {
+	Cursor      string              `json:"cursor"` // Pass as since on the next sync
+	Full        bool                `json:"full"`   // The device should replace its catalog rather than merge
+	Products    []models.Product    `json:"products"`
+	Variants    []models.Variant    `json:"variants"`
+	StockLevels []models.StockLevel `json:"stock_levels"`
+	Vendors     []models.Vendor     `json:"vendors"`
+	Tombstones  []SyncTombstone     `json:"tombstones"`
+}
+
+type SyncService struct{}
+
+func NewSyncService() *SyncService {
+	return &SyncService{}
+}
+
+// RecordDeleted remembers hard-deleted catalog records so syncing devices drop them.
+// Tombstones older than TombstoneRetention are pruned at the same time.
+func (s *SyncService) RecordDeleted(tx *gorm.DB, orgID uuid.UUID, entityType string, ids ...uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("organization_id = ? AND created_at < ?", orgID, time.Now().Add(-TombstoneRetention)).
+		Delete(&models.Tombstone{}).Error; err != nil {
+		return err
+	}
+
+	tombstones := make([]models.Tombstone, len(ids))
+	for i, id := range ids {
+		tombstones[i] = models.Tombstone{OrganizationID: orgID, EntityType: entityType, EntityID: id}
+	}
+	return tx.Create(&tombstones).Error
+}
+
+// CatalogChanges returns the catalog changes since cursor, or the whole active catalog when cursor
+// is empty or older than TombstoneRetention. Stock levels are limited to locationID when it is set.
+func (s *SyncService) CatalogChanges(tx *gorm.DB, orgID uuid.UUID, cursor string, locationID *uuid.UUID) (*CatalogChanges, error) {
+	now := time.Now().UTC()
+	changes := &CatalogChanges{
+		Cursor:      now.Format(time.RFC3339Nano),
+		Products:    []models.Product{},
+		Variants:    []models.Variant{},
+		StockLevels: []models.StockLevel{},
+		Vendors:     []models.Vendor{},
+		Tombstones:  []SyncTombstone{},
+	}
+
+	var since time.Time
+	if cursor != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, cursor)
+		if err != nil || parsed.After(now) {
+			return nil, ErrInvalidSyncCursor
+		}
+		since = parsed.Add(-SyncOverlap)
+	}
+	changes.Full = cursor == "" || since.Before(now.Add(-TombstoneRetention))
+
+	var products []models.Product
+	query := tx.Where("organization_id = ?", orgID).
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") })
+	if changes.Full {
+		query = query.Where("status = ?", models.CatalogStatusActive)
+	} else {
+		query = query.Where("updated_at > ?", since)
+	}
+	if err := query.Find(&products).Error; err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		if product.Status == models.CatalogStatusActive {
+			changes.Products = append(changes.Products, product)
+		} else {
+			changes.Tombstones = append(changes.Tombstones, statusTombstone(models.TombstoneProduct, product.ID, product.Status, product.UpdatedAt))
+		}
+	}
+
+	// A product that comes back from archive or draft brings all its variants with it
+	var variants []models.Variant
+	query = tx.Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ? AND products.status = ?", orgID, models.CatalogStatusActive).
+		Preload("Barcodes").
+		Preload("Packs")
+	if changes.Full {
+		query = query.Where("variants.status = ?", models.CatalogStatusActive)
+	} else {
+		query = query.Where("variants.updated_at > ? OR products.updated_at > ?", since, since)
+	}
+	if err := query.Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		if variant.Status == models.CatalogStatusActive {
+			changes.Variants = append(changes.Variants, variant)
+		} else {
+			changes.Tombstones = append(changes.Tombstones, statusTombstone(models.TombstoneVariant, variant.ID, variant.Status, variant.UpdatedAt))
+		}
+	}
+
+	query = tx.Joins("JOIN variants ON variants.id = stock_levels.variant_id").
+		Joins("JOIN products ON products.id = variants.product_id").
+		Where("products.organization_id = ? AND products.status = ? AND variants.status = ?",
+			orgID, models.CatalogStatusActive, models.CatalogStatusActive)
+	if locationID != nil {
+		query = query.Where("stock_levels.location_id = ?", *locationID)
+	}
+	if !changes.Full {
+		query = query.Where("stock_levels.updated_at > ? OR variants.updated_at > ? OR products.updated_at > ?", since, since, since)
+	}
+	if err := query.Find(&changes.StockLevels).Error; err != nil {
+		return nil, err
+	}
+
+	query = tx.Where("organization_id = ?", orgID)
+	if !changes.Full {
+		query = query.Where("updated_at > ?", since)
+	}
+	if err := query.Find(&changes.Vendors).Error; err != nil {
+		return nil, err
+	}
+
+	if !changes.Full {
+		var tombstones []models.Tombstone
+		if err := tx.Where("organization_id = ? AND created_at > ?", orgID, since).
+			Order("created_at ASC").
+			Find(&tombstones).Error; err != nil {
+			return nil, err
+		}
+		for _, tombstone := range tombstones {
+			changes.Tombstones = append(changes.Tombstones, SyncTombstone{
+				Type:   tombstone.EntityType,
+				ID:     tombstone.EntityID,
+				Reason: SyncRemovedDeleted,
+				At:     tombstone.CreatedAt,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// statusTombstone reports a product or variant that is no longer sold as removed
+func statusTombstone(entityType string, id uuid.UUID, status string, at time.Time) SyncTombstone {
+	reason := SyncRemovedArchived
+	if status == models.CatalogStatusDraft {
+		reason = SyncRemovedDraft
+	}
+	return SyncTombstone{Type: entityType, ID: id, Reason: reason, At: at}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTransferStatus          = errors.New("transfer is not in a valid status for this action")
+	ErrInvalidReceivedQuantity = errors.New("invalid received quantity")
+)
+
+// TransferStockError is returned when the source location cannot cover a transfer line
+type TransferStockError struct {
+	VariantID uuid.UUID
+	Available float64
+	Requested float64
+}
+
+func (e *TransferStockError) Error() string {
+	return fmt.Sprintf("insufficient stock to transfer variant %s: available %g, requested %g", e.VariantID, e.Available, e.Requested)
+}
+
+type TransferService struct{}
+
+func NewTransferService() *TransferService {
+	return &TransferService{}
+}
+
+// Dispatch deducts every line from the source location and marks the transfer as in transit.
+// The transfer must be loaded with Items; the caller owns the transaction.
+func (s *TransferService) Dispatch(tx *gorm.DB, transfer *models.StockTransfer, userID uuid.UUID) error {
+	if transfer.Status != models.TransferStatusDraft {
+		return ErrTransferStatus
+	}
+
+	inventoryService := NewInventoryService()
+	for _, item := range transfer.Items {
+		variant, err := inventoryService.LockVariant(tx, transfer.OrganizationID, item.VariantID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+			OrganizationID: transfer.OrganizationID,
+			LocationID:     &transfer.SourceLocationID,
+			UserID:         userID,
+			Delta:          -item.Quantity,
+			ReasonCode:     models.MovementReasonTransferOut,
+			SourceType:     models.MovementSourceTransfer,
+			SourceID:       &transfer.ID,
+		}); err != nil {
+			if errors.Is(err, ErrNegativeStock) {
+				level, levelErr := inventoryService.LockStockLevel(tx, variant.ID, transfer.SourceLocationID)
+				if levelErr != nil {
+					return levelErr
+				}
+				return &TransferStockError{VariantID: item.VariantID, Available: level.Quantity, Requested: item.Quantity}
+			}
+			return err
+		}
+	}
+
+	now := time.Now()
+	transfer.Status = models.TransferStatusDispatched
+	transfer.DispatchedBy = &userID
+	transfer.DispatchedAt = &now
+	return tx.Model(transfer).Updates(map[string]interface{}{
+		"status":        transfer.Status,
+		"dispatched_by": transfer.DispatchedBy,
+		"dispatched_at": transfer.DispatchedAt,
+	}).Error
+}
+
+// Receive adds the received quantities at the destination location. Lines missing from received
+// are taken as fully received; any shortfall is recorded as a discrepancy on the line and written
+// off at the destination as a loss.
+// The transfer must be loaded with Items; the caller owns the transaction.
+func (s *TransferService) Receive(tx *gorm.DB, transfer *models.StockTransfer, userID uuid.UUID, received map[uuid.UUID]float64) error {
+	if transfer.Status != models.TransferStatusDispatched {
+		return ErrTransferStatus
+	}
+
+	for variantID := range received {
+		if !transferHasVariant(transfer, variantID) {
+			return fmt.Errorf("%w: variant %s is not on this transfer", ErrInvalidReceivedQuantity, variantID)
+		}
+	}
+
+	inventoryService := NewInventoryService()
+	for i := range transfer.Items {
+		item := &transfer.Items[i]
+
+		quantity := item.Quantity
+		if q, ok := received[item.VariantID]; ok {
+			quantity = q
+		}
+		if quantity < 0 || quantity > item.Quantity {
+			return fmt.Errorf("%w: variant %s must be between 0 and %g", ErrInvalidReceivedQuantity, item.VariantID, item.Quantity)
+		}
+
+		variant, err := inventoryService.LockVariant(tx, transfer.OrganizationID, item.VariantID)
+		if err != nil {
+			return err
+		}
+		if !models.ValidQuantity(quantity, variant.UnitType) {
+			return fmt.Errorf("%w: variant %s is counted to %d decimals", ErrInvalidReceivedQuantity, item.VariantID, models.QuantityPrecision(variant.UnitType))
+		}
+
+		if _, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+			OrganizationID: transfer.OrganizationID,
+			LocationID:     &transfer.DestinationLocationID,
+			UserID:         userID,
+			Delta:          item.Quantity,
+			ReasonCode:     models.MovementReasonTransferIn,
+			SourceType:     models.MovementSourceTransfer,
+			SourceID:       &transfer.ID,
+		}); err != nil {
+			return err
+		}
+
+		// The shortfall is posted as a loss so it leaves the cost layers and is valued like any other write-off
+		shortfall := models.RoundQuantity(item.Quantity - quantity)
+		if shortfall > 0 {
+			if _, err := inventoryService.ApplyStockChange(tx, variant, StockChange{
+				OrganizationID: transfer.OrganizationID,
+				LocationID:     &transfer.DestinationLocationID,
+				UserID:         userID,
+				Delta:          -shortfall,
+				ReasonCode:     models.MovementReasonTheft,
+				SourceType:     models.MovementSourceTransfer,
+				SourceID:       &transfer.ID,
+				Note:           "Lost in transit",
+			}); err != nil {
+				return err
+			}
+		}
+
+		item.QuantityReceived = &quantity
+		item.Discrepancy = shortfall
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"quantity_received": quantity,
+			"discrepancy":       item.Discrepancy,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	transfer.Status = models.TransferStatusReceived
+	transfer.ReceivedBy = &userID
+	transfer.ReceivedAt = &now
+	return tx.Model(transfer).Updates(map[string]interface{}{
+		"status":      transfer.Status,
+		"received_by": transfer.ReceivedBy,
+		"received_at": transfer.ReceivedAt,
+	}).Error
+}
+
+func transferHasVariant(transfer *models.StockTransfer, variantID uuid.UUID) bool {
+	for _, item := range transfer.Items {
+		if item.VariantID == variantID {
+			return true
+		}
+	}
+	return false
+}
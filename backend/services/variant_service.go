@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bstock/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLastVariant          = errors.New("a product must keep at least one variant that is not archived")
+	ErrVariantOrderMismatch = errors.New("variant order must list each variant of the product that is not archived exactly once")
+	ErrUnknownUnit          = errors.New("unknown unit type")
+)
+
+// UnitChangeError is returned when a variant's quantities can't be expressed in the unit it is changed to
+type UnitChangeError struct {
+	VariantID uuid.UUID
+	UnitType  string
+	Field     string // quantity, min_stock_level, stock_level or pack
+	Quantity  float64
+}
+
+func (e *UnitChangeError) Error() string {
+	return fmt.Sprintf("variant %s can't change to %s: %s %g has more than %d decimals",
+		e.VariantID, e.UnitType, e.Field, e.Quantity, models.QuantityPrecision(e.UnitType))
+}
+
+// VariantUnavailableError is returned when a live sale references a draft or archived variant or product
+type VariantUnavailableError struct {
+	VariantID uuid.UUID
+	Status    string
+}
+
+func (e *VariantUnavailableError) Error() string {
+	return fmt.Sprintf("variant %s is %s", e.VariantID, e.Status)
+}
+
+// variantHistory lists the records that keep a variant from being hard-deleted
+var variantHistory = []interface{}{
+	&models.SaleItem{},
+	&models.SaleReturnItem{},
+	&models.StockMovement{},
+	&models.StockConflict{},
+	&models.PurchaseOrderLine{},
+	&models.GoodsReceiptItem{},
+	&models.StockTransferItem{},
+	&models.StocktakeItem{},
+}
+
+type VariantService struct{}
+
+func NewVariantService() *VariantService {
+	return &VariantService{}
+}
+
+// NextPosition returns the display position after the product's last variant
+func (s *VariantService) NextPosition(tx *gorm.DB, productID uuid.UUID) (int, error) {
+	var position int
+	err := tx.Model(&models.Variant{}).
+		Where("product_id = ?", productID).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&position).Error
+	return position, err
+}
+
+// ValidateUnitChange checks that unitType is a known unit and that the variant's stock, stock levels,
+// minimum stock level and pack factors can all be held in it, so a kg variant holding 0.75 can't become pcs.
+// packs are the pack units the variant will have; nil means its current ones.
+func (s *VariantService) ValidateUnitChange(tx *gorm.DB, variant *models.Variant, unitType string, packs []models.PackUnit) error {
+	if !models.KnownUnit(unitType) {
+		return fmt.Errorf("%w: %s", ErrUnknownUnit, unitType)
+	}
+
+	check := func(field string, quantity float64) error {
+		if models.ValidQuantity(quantity, unitType) {
+			return nil
+		}
+		return &UnitChangeError{VariantID: variant.ID, UnitType: unitType, Field: field, Quantity: quantity}
+	}
+	if err := check("quantity", variant.Quantity); err != nil {
+		return err
+	}
+	if err := check("min_stock_level", variant.MinStockLevel); err != nil {
+		return err
+	}
+
+	var levels []models.StockLevel
+	if err := tx.Where("variant_id = ?", variant.ID).Find(&levels).Error; err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if err := check("stock_level", level.Quantity); err != nil {
+			return err
+		}
+	}
+
+	if packs == nil {
+		if err := tx.Where("variant_id = ?", variant.ID).Find(&packs).Error; err != nil {
+			return err
+		}
+	}
+	for _, pack := range packs {
+		if err := check("pack", pack.Factor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove hard-deletes a variant that has never been used, and archives one that holds stock or that sales,
+// stock or purchasing records still point to. It reports whether the variant was archived.
+func (s *VariantService) Remove(tx *gorm.DB, variant *models.Variant) (bool, error) {
+	if variant.Status != models.CatalogStatusArchived {
+		if err := s.ensureNotLast(tx, variant); err != nil {
+			return false, err
+		}
+	}
+
+	used, err := s.HasHistory(tx, variant)
+	if err != nil {
+		return false, err
+	}
+	if used {
+		return true, s.Archive(tx, variant)
+	}
+
+	if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.CostLayer{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Delete(variant).Error; err != nil {
+		return false, err
+	}
+
+	var orgID uuid.UUID
+	if err := tx.Model(&models.Product{}).Where("id = ?", variant.ProductID).Select("organization_id").Scan(&orgID).Error; err != nil {
+		return false, err
+	}
+	return false, NewSyncService().RecordDeleted(tx, orgID, models.TombstoneVariant, variant.ID)
+}
+
+// HasHistory reports whether a variant holds stock or is referenced by sales, stock or purchasing records
+func (s *VariantService) HasHistory(tx *gorm.DB, variant *models.Variant) (bool, error) {
+	if variant.Quantity != 0 {
+		return true, nil
+	}
+
+	for _, model := range variantHistory {
+		var count int64
+		if err := tx.Model(model).Where("variant_id = ?", variant.ID).Limit(1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Archive retires a variant: it stays on historical records but no longer sells or shows in the catalog
+func (s *VariantService) Archive(tx *gorm.DB, variant *models.Variant) error {
+	if variant.Status == models.CatalogStatusArchived {
+		return nil
+	}
+	if err := s.ensureNotLast(tx, variant); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(variant).Updates(map[string]interface{}{
+		"status":      models.CatalogStatusArchived,
+		"archived_at": now,
+		"version":     gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	variant.Status = models.CatalogStatusArchived
+	variant.ArchivedAt = &now
+	variant.Version++
+	return nil
+}
+
+// Restore makes an archived variant active again, at the end of the product's display order
+func (s *VariantService) Restore(tx *gorm.DB, variant *models.Variant) error {
+	if variant.Status != models.CatalogStatusArchived {
+		return nil
+	}
+
+	// The product's attributes may have changed, or another variant taken the same values, while it was archived
+	if _, err := NewAttributeService().ValidateVariantAttributes(tx, variant.ProductID, variant.ID, variant.Attributes); err != nil {
+		return err
+	}
+
+	position, err := s.NextPosition(tx, variant.ProductID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(variant).Updates(map[string]interface{}{
+		"status":      models.CatalogStatusActive,
+		"archived_at": nil,
+		"position":    position,
+		"version":     gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	variant.Status = models.CatalogStatusActive
+	variant.ArchivedAt = nil
+	variant.Position = position
+	variant.Version++
+	return nil
+}
+
+// Update saves an edited variant, provided nobody else saved it since it was read at version.
+// It returns ErrVersionConflict otherwise. Quantity is never written here; it only changes through
+// stock movements.
+func (s *VariantService) Update(tx *gorm.DB, variant *models.Variant, version int) error {
+	return saveVersioned(tx, variant, &variant.Version, version, "quantity")
+}
+
+// Reorder sets the display order of a product's variants that are not archived to the order of variantIDs
+func (s *VariantService) Reorder(tx *gorm.DB, productID uuid.UUID, variantIDs []uuid.UUID) error {
+	var active []uuid.UUID
+	if err := tx.Model(&models.Variant{}).
+		Where("product_id = ? AND status <> ?", productID, models.CatalogStatusArchived).
+		Pluck("id", &active).Error; err != nil {
+		return err
+	}
+
+	if len(variantIDs) != len(active) {
+		return ErrVariantOrderMismatch
+	}
+	remaining := make(map[uuid.UUID]bool, len(active))
+	for _, id := range active {
+		remaining[id] = true
+	}
+	for _, id := range variantIDs {
+		if !remaining[id] {
+			return ErrVariantOrderMismatch
+		}
+		delete(remaining, id)
+	}
+
+	for position, id := range variantIDs {
+		if err := tx.Model(&models.Variant{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"position": position,
+			"version":  gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *VariantService) ensureNotLast(tx *gorm.DB, variant *models.Variant) error {
+	var others int64
+	if err := tx.Model(&models.Variant{}).
+		Where("product_id = ? AND id <> ? AND status <> ?", variant.ProductID, variant.ID, models.CatalogStatusArchived).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastVariant
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Storage keeps uploaded files under slash-separated keys such as "orgs/<org>/products/<product>/<file>"
+type Storage interface {
+	Put(key string, body io.Reader, size int64, contentType string) error
+	Open(key string) (*Object, error)
+	Delete(key string) error
+	// SignedURL returns a URL that downloads key without authentication until ttl passes
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Object is an opened file; the caller must close Body
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+}
+
+// Default is the backend used by the application, replaced by Setup at startup
+var Default Storage = NewLocalStorage("./uploads", "")
+
+// Setup configures Default from the environment (STORAGE_DRIVER, default "local") and loads the
+// secret that signs file URLs
+func Setup() error {
+	if err := loadSigningSecret(); err != nil {
+		return err
+	}
+
+	switch driver := getEnv("STORAGE_DRIVER", "local"); driver {
+	case "local":
+		local := NewLocalStorage(getEnv("STORAGE_LOCAL_DIR", "./uploads"), os.Getenv("PUBLIC_BASE_URL"))
+		if err := os.MkdirAll(local.Root, 0755); err != nil {
+			return err
+		}
+		Default = local
+	case "s3":
+		region := getEnv("STORAGE_S3_REGION", "us-east-1")
+		bucket := os.Getenv("STORAGE_S3_BUCKET")
+		if bucket == "" {
+			return errors.New("STORAGE_S3_BUCKET is required for the s3 storage driver")
+		}
+		Default = NewS3Storage(
+			getEnv("STORAGE_S3_ENDPOINT", "https://s3."+region+".amazonaws.com"),
+			region,
+			bucket,
+			os.Getenv("STORAGE_S3_ACCESS_KEY"),
+			os.Getenv("STORAGE_S3_SECRET_KEY"),
+			os.Getenv("STORAGE_S3_PATH_STYLE") == "true",
+		)
+	default:
+		return fmt.Errorf("unknown storage driver %q", driver)
+	}
+	return nil
+}
+
+// CleanKey rejects keys that are empty, absolute or escape their prefix
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+// SanitizeFilename reduces a client-supplied file name to a safe base name of letters, digits, ".", "-" and "_"
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	var b strings.Builder
+	dash := false
+	for _, r := range name {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '.', r == '_':
+			b.WriteRune(r)
+			dash = false
+		case !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	cleaned := strings.Trim(b.String(), ".-")
+	if len(cleaned) > 64 {
+		cleaned = cleaned[len(cleaned)-64:]
+	}
+	if cleaned == "" {
+		return "file"
+	}
+	return cleaned
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
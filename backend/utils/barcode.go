@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Barcode symbologies accepted on variants
+const (
+	SymbologyEAN13   = "ean13"
+	SymbologyUPCA    = "upca"
+	SymbologyCode128 = "code128"
+)
+
+const maxCode128Length = 80
+
+var ErrInvalidBarcode = errors.New("invalid barcode")
+
+// ParseBarcode trims a scanned or typed barcode, detects its symbology and validates it.
+// Twelve and thirteen digit codes are UPC-A and EAN-13 and must carry a valid check digit;
+// anything else is treated as Code128, whose check symbol is not part of the data and so
+// is only checked for printable ASCII and length.
+func ParseBarcode(raw string) (code string, symbology string, err error) {
+	code = strings.TrimSpace(raw)
+	if code == "" {
+		return "", "", fmt.Errorf("%w: empty", ErrInvalidBarcode)
+	}
+
+	if isDigits(code) && (len(code) == 12 || len(code) == 13) {
+		if !validGTINCheckDigit(code) {
+			return "", "", fmt.Errorf("%w: %s has a wrong check digit", ErrInvalidBarcode, code)
+		}
+		if len(code) == 12 {
+			return code, SymbologyUPCA, nil
+		}
+		return code, SymbologyEAN13, nil
+	}
+
+	if len(code) > maxCode128Length {
+		return "", "", fmt.Errorf("%w: longer than %d characters", ErrInvalidBarcode, maxCode128Length)
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 32 || code[i] > 126 {
+			return "", "", fmt.Errorf("%w: %q contains characters Code128 cannot encode", ErrInvalidBarcode, code)
+		}
+	}
+	return code, SymbologyCode128, nil
+}
+
+// BarcodeLookupCandidates returns the forms a code may be stored under. Scanners configured for
+// EAN-13 report UPC-A codes with a leading zero, and the reverse.
+func BarcodeLookupCandidates(code string) []string {
+	code = strings.TrimSpace(code)
+	candidates := []string{code}
+	if isDigits(code) {
+		if len(code) == 13 && code[0] == '0' {
+			candidates = append(candidates, code[1:])
+		} else if len(code) == 12 {
+			candidates = append(candidates, "0"+code)
+		}
+	}
+	return candidates
+}
+
+// validGTINCheckDigit checks the mod-10 check digit shared by EAN-13 and UPC-A
+func validGTINCheckDigit(code string) bool {
+	sum := 0
+	weight := 3
+	for i := len(code) - 2; i >= 0; i-- {
+		sum += int(code[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ValidPLU reports whether plu is 1 to 9 digits and not all zeros. Scales pad PLUs with leading
+// zeros, so an all-zero PLU would be indistinguishable from a variant without one.
+func ValidPLU(plu string) bool {
+	return len(plu) <= 9 && isDigits(plu) && strings.Trim(plu, "0") != ""
+}
+
+// ScaleBarcodePrefix returns the two-digit prefix of an in-store EAN-13 (prefixes 20 to 29),
+// as printed by shop scales with a PLU and a weight or price embedded.
+func ScaleBarcodePrefix(code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != 13 || !isDigits(code) || code[0] != '2' || !validGTINCheckDigit(code) {
+		return "", false
+	}
+	return code[:2], true
+}
+
+// DecodeScaleBarcode splits an in-store EAN-13 laid out as prefix (2 digits), PLU (pluLength digits),
+// value (the remaining 10-pluLength digits) and check digit. The value is scaled by valueDecimals,
+// so a weight in grams printed as 01250 with 3 decimals reads 1.25.
+func DecodeScaleBarcode(code string, pluLength, valueDecimals int) (plu string, value float64, err error) {
+	if _, ok := ScaleBarcodePrefix(code); !ok {
+		return "", 0, fmt.Errorf("%w: %s is not an in-store EAN-13", ErrInvalidBarcode, code)
+	}
+	if pluLength < 1 || pluLength > 9 {
+		return "", 0, fmt.Errorf("%w: PLU length %d does not fit an EAN-13", ErrInvalidBarcode, pluLength)
+	}
+
+	code = strings.TrimSpace(code)
+	plu = code[2 : 2+pluLength]
+	if !ValidPLU(plu) {
+		return "", 0, fmt.Errorf("%w: %s carries no PLU", ErrInvalidBarcode, code)
+	}
+
+	raw := 0
+	for i := 2 + pluLength; i < 12; i++ {
+		raw = raw*10 + int(code[i]-'0')
+	}
+	// A single division rounds correctly, so 199 with 2 decimals is exactly 1.99
+	value = float64(raw) / math.Pow10(valueDecimals)
+
+	return plu, value, nil
+}
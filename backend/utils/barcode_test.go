@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseBarcode(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		wantCode      string
+		wantSymbology string
+		wantErr       bool
+	}{
+		{"ean13", "4006381333931", "4006381333931", SymbologyEAN13, false},
+		{"upca", "036000291452", "036000291452", SymbologyUPCA, false},
+		{"trimmed", "  4006381333931\n", "4006381333931", SymbologyEAN13, false},
+		{"code128", "SKU-42/a b", "SKU-42/a b", SymbologyCode128, false},
+		{"short digits are code128", "12345", "12345", SymbologyCode128, false},
+		{"ean13 wrong check digit", "4006381333932", "", "", true},
+		{"upca wrong check digit", "036000291453", "", "", true},
+		{"empty", "   ", "", "", true},
+		{"too long", strings.Repeat("A", maxCode128Length+1), "", "", true},
+		{"longest code128", strings.Repeat("A", maxCode128Length), strings.Repeat("A", maxCode128Length), SymbologyCode128, false},
+		{"control character", "AB\x01C", "", "", true},
+		{"non-ascii", "ጤፍ-1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, symbology, err := ParseBarcode(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidBarcode) {
+					t.Fatalf("ParseBarcode(%q) err = %v, want ErrInvalidBarcode", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBarcode(%q) err = %v", tt.raw, err)
+			}
+			if code != tt.wantCode || symbology != tt.wantSymbology {
+				t.Errorf("ParseBarcode(%q) = %q, %q, want %q, %q", tt.raw, code, symbology, tt.wantCode, tt.wantSymbology)
+			}
+		})
+	}
+}
+
+func TestDecodeScaleBarcode(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		pluLength     int
+		valueDecimals int
+		wantPLU       string
+		wantValue     float64
+		wantErr       bool
+	}{
+		{"weight in grams", "2012345012509", 5, 3, "12345", 1.25, false},
+		{"price in cents", "2100042001992", 5, 2, "00042", 1.99, false},
+		{"whole value", "2100042001992", 5, 0, "00042", 199, false},
+		{"four digit plu", "2100042001992", 4, 2, "0004", 2001.99, false},
+		{"not in-store", "4006381333931", 5, 3, "", 0, true},
+		{"wrong check digit", "2012345012508", 5, 3, "", 0, true},
+		{"plu length zero", "2012345012509", 0, 3, "", 0, true},
+		{"plu length too long", "2012345012509", 10, 3, "", 0, true},
+		{"all-zero plu", "2000000012506", 5, 3, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plu, value, err := DecodeScaleBarcode(tt.code, tt.pluLength, tt.valueDecimals)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidBarcode) {
+					t.Fatalf("DecodeScaleBarcode(%q) err = %v, want ErrInvalidBarcode", tt.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeScaleBarcode(%q) err = %v", tt.code, err)
+			}
+			if plu != tt.wantPLU || value != tt.wantValue {
+				t.Errorf("DecodeScaleBarcode(%q) = %q, %v, want %q, %v", tt.code, plu, value, tt.wantPLU, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestValidPLU(t *testing.T) {
+	tests := []struct {
+		plu  string
+		want bool
+	}{
+		{"1", true},
+		{"00042", true},
+		{"123456789", true},
+		{"", false},
+		{"0", false},
+		{"00000", false},
+		{"1234567890", false},
+		{"12a", false},
+		{" 42", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidPLU(tt.plu); got != tt.want {
+			t.Errorf("ValidPLU(%q) = %v, want %v", tt.plu, got, tt.want)
+		}
+	}
+}
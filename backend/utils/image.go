@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales src down so its longest side is at most maxSide, averaging the source pixels each
+// output pixel covers. Transparency is flattened onto white so the result can be encoded as JPEG.
+func Thumbnail(src image.Image, maxSide int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			thumbWidth, thumbHeight = maxSide, height*maxSide/width
+		} else {
+			thumbWidth, thumbHeight = width*maxSide/height, maxSide
+		}
+	}
+	if thumbWidth < 1 {
+		thumbWidth = 1
+	}
+	if thumbHeight < 1 {
+		thumbHeight = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := bounds.Min.Y + (y+1)*height/thumbHeight
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := bounds.Min.X + (x+1)*width/thumbWidth
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// Premultiplied colour over white
+			white := 0xffff - a/n
+			thumb.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+
+	return thumb
+}
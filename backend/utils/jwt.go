@@ -9,17 +9,19 @@ import (
 )
 
 type Claims struct {
-	UserID         uuid.UUID `json:"user_id"`
-	OrganizationID uuid.UUID `json:"organization_id"`
-	Role           string    `json:"role"`
+	UserID         uuid.UUID  `json:"user_id"`
+	OrganizationID uuid.UUID  `json:"organization_id"`
+	Role           string     `json:"role"`
+	LocationID     *uuid.UUID `json:"location_id,omitempty"` // Set for users assigned to a single location
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID, organizationID uuid.UUID, role string) (string, error) {
+func GenerateJWT(userID, organizationID uuid.UUID, role string, locationID *uuid.UUID) (string, error) {
 	claims := &Claims{
 		UserID:         userID,
 		OrganizationID: organizationID,
 		Role:           role,
+		LocationID:     locationID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Ethiopic syllables are laid out in rows of eight: one consonant followed by its vowel orders
+const (
+	ethiopicStart = 0x1200
+	ethiopicEnd   = 0x137F
+)
+
+// ethiopicConsonants holds the Latin spelling of each row's consonant, indexed by (rune-0x1200)/8.
+// Rows for the glottal stop (አ, ዐ) are empty so only the vowel is written.
+var ethiopicConsonants = []string{
+	"h", "l", "h", "m", "s", "r", "s", "sh", // ሀ ለ ሐ መ ሠ ረ ሰ ሸ
+	"q", "qw", "qh", "qhw", "b", "v", "t", "ch", // ቀ ቈ ቐ ቘ በ ቨ ተ ቸ
+	"h", "hw", "n", "ny", "", "k", "kw", "kh", // ኀ ኈ ነ ኘ አ ከ ኰ ኸ
+	"khw", "w", "", "z", "zh", "y", "d", "d", // ዀ ወ ዐ ዘ ዠ የ ደ ዸ
+	"j", "g", "gw", "g", "t", "ch", "p", "ts", // ጀ ገ ጐ ጘ ጠ ጨ ጰ ጸ
+	"ts", "f", "p", // ፀ ፈ ፐ
+}
+
+// ethiopicVowels are the vowels of the eight orders; the sixth order is usually silent
+var ethiopicVowels = []string{"e", "u", "i", "a", "e", "", "o", "wa"}
+
+// glottalVowels replace ethiopicVowels on the glottal rows, where the sixth order is voiced
+var glottalVowels = []string{"a", "u", "i", "a", "e", "i", "o", "wa"}
+
+// TransliterateEthiopic spells Ethiopic (Amharic, Tigrinya) text in Latin letters the way
+// names are commonly typed, e.g. "እንጀራ" becomes "injera". Other text is returned unchanged.
+func TransliterateEthiopic(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < ethiopicStart || r > ethiopicEnd {
+			b.WriteRune(r)
+			continue
+		}
+
+		row, order := int(r-ethiopicStart)/8, int(r-ethiopicStart)%8
+		if row >= len(ethiopicConsonants) {
+			// Punctuation and numerals separate words
+			b.WriteRune(' ')
+			continue
+		}
+		consonant := ethiopicConsonants[row]
+		if consonant == "" {
+			b.WriteString(glottalVowels[order])
+		} else {
+			b.WriteString(consonant)
+			b.WriteString(ethiopicVowels[order])
+		}
+	}
+	return b.String()
+}
+
+// SearchText builds the text a record is indexed under for fuzzy search: the given fields
+// lowercased and joined, followed by a Latin transliteration when any of them is in Ethiopic
+// script so that either spelling finds the record.
+func SearchText(fields ...string) string {
+	text := NormalizeSearch(strings.Join(fields, " "))
+	if transliterated := TransliterateEthiopic(text); transliterated != text {
+		text += " " + transliterated
+	}
+	return text
+}
+
+// NormalizeSearch lowercases s and collapses punctuation and runs of whitespace into single spaces
+func NormalizeSearch(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != '-'
+	}), " ")
+}
@@ -0,0 +1,37 @@
+package utils
+
+// formulaTriggers are the leading characters that make spreadsheet apps read a CSV cell as a formula
+const formulaTriggers = "=+-@\t\r"
+
+// EscapeSpreadsheetText prefixes text that a spreadsheet app would run as a formula with a quote,
+// which spreadsheets show as plain text. UnescapeSpreadsheetText reverses it.
+func EscapeSpreadsheetText(s string) string {
+	if needsSpreadsheetEscape(s) {
+		return "'" + s
+	}
+	return s
+}
+
+// UnescapeSpreadsheetText removes the quote added by EscapeSpreadsheetText
+func UnescapeSpreadsheetText(s string) string {
+	if len(s) > 1 && s[0] == '\'' && needsSpreadsheetEscape(s[1:]) {
+		return s[1:]
+	}
+	return s
+}
+
+// needsSpreadsheetEscape also covers text that already starts with a quote before a trigger,
+// so that such text survives an export and import unchanged
+func needsSpreadsheetEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\'' {
+			for j := 0; j < len(formulaTriggers); j++ {
+				if s[i] == formulaTriggers[j] {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestEscapeSpreadsheetText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Teff flour", "Teff flour"},
+		{"", ""},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+251911000000", "'+251911000000"},
+		{"-5% promo", "'-5% promo"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tindented", "'\tindented"},
+		{"'=already quoted", "''=already quoted"},
+		{"'quoted", "'quoted"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tt := range tests {
+		got := EscapeSpreadsheetText(tt.text)
+		if got != tt.want {
+			t.Errorf("EscapeSpreadsheetText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if back := UnescapeSpreadsheetText(got); back != tt.text {
+			t.Errorf("UnescapeSpreadsheetText(%q) = %q, want %q", got, back, tt.text)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidXLSX = errors.New("invalid xlsx file")
+
+// Worksheet bounds. Excel itself stops at row 1048576 and column XFD; MaxXLSXRows caps what is
+// accepted so a small file can't make the reader allocate millions of empty rows or cells.
+const (
+	xlsxRowLimit    = 1048576
+	xlsxColumnLimit = 16384
+	MaxXLSXRows     = 50000
+	maxXLSXCells    = 2000000
+)
+
+// ReadXLSX returns the cells of the first worksheet of an Office Open XML workbook as rows of strings.
+// Only the values are read: numbers come back as written in the file, styles and formulas are ignored.
+func ReadXLSX(r io.ReaderAt, size int64) ([][]string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	sharedStrings, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := files[firstSheetPath(files)]
+	if sheet == nil {
+		return nil, fmt.Errorf("%w: no worksheet found", ErrInvalidXLSX)
+	}
+
+	return readSheet(sheet, sharedStrings)
+}
+
+// firstSheetPath resolves the first sheet listed in the workbook, falling back to the conventional name
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if decodeZipXML(files["xl/workbook.xml"], &workbook) != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+	if decodeZipXML(files["xl/_rels/workbook.xml.rels"], &rels) != nil {
+		return fallback
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].ID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/")
+			}
+			return path.Join("xl", rel.Target)
+		}
+	}
+	return fallback
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeZipXML(f, &table); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+
+	values := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		if len(item.Runs) == 0 {
+			values[i] = item.Text
+			continue
+		}
+		var b strings.Builder
+		for _, run := range item.Runs {
+			b.WriteString(run.Text)
+		}
+		values[i] = b.String()
+	}
+	return values, nil
+}
+
+// readSheet streams the worksheet so large sheets are not held in memory as a DOM
+func readSheet(f *zip.File, sharedStrings []string) ([][]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+	defer rc.Close()
+
+	type cell struct {
+		Ref        string `xml:"r,attr"`
+		Type       string `xml:"t,attr"`
+		Value      string `xml:"v"`
+		InlineText string `xml:"is>t"`
+	}
+
+	var rows [][]string
+	cells := 0
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "row":
+			rowNumber := len(rows) + 1
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "r" {
+					n, err := strconv.Atoi(attr.Value)
+					if err != nil || n < 1 || n > xlsxRowLimit {
+						return nil, fmt.Errorf("%w: bad row number %q", ErrInvalidXLSX, attr.Value)
+					}
+					if n > rowNumber {
+						rowNumber = n
+					}
+				}
+			}
+			if rowNumber > MaxXLSXRows {
+				return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidXLSX, MaxXLSXRows)
+			}
+			for len(rows) < rowNumber {
+				rows = append(rows, nil)
+			}
+		case "c":
+			if len(rows) == 0 {
+				rows = append(rows, nil)
+			}
+			var c cell
+			if err := decoder.DecodeElement(&c, &start); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+			}
+
+			value := c.Value
+			switch c.Type {
+			case "s":
+				index, err := strconv.Atoi(c.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings) {
+					return nil, fmt.Errorf("%w: bad shared string in %s", ErrInvalidXLSX, c.Ref)
+				}
+				value = sharedStrings[index]
+			case "inlineStr":
+				value = c.InlineText
+			}
+
+			row := &rows[len(rows)-1]
+			column := len(*row)
+			if c.Ref != "" {
+				index, ok := columnIndex(c.Ref)
+				if !ok {
+					return nil, fmt.Errorf("%w: bad cell reference %q", ErrInvalidXLSX, c.Ref)
+				}
+				column = index
+			}
+			if column >= xlsxColumnLimit {
+				return nil, fmt.Errorf("%w: too many columns in row %d", ErrInvalidXLSX, len(rows))
+			}
+			if grow := column + 1 - len(*row); grow > 0 {
+				if cells += grow; cells > maxXLSXCells {
+					return nil, fmt.Errorf("%w: more than %d cells", ErrInvalidXLSX, maxXLSXCells)
+				}
+			}
+			for len(*row) <= column {
+				*row = append(*row, "")
+			}
+			(*row)[column] = value
+		}
+	}
+
+	return rows, nil
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" to a zero-based column.
+// References without letters or past column XFD are rejected.
+func columnIndex(ref string) (int, bool) {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		if index > xlsxColumnLimit {
+			return 0, false
+		}
+		letters++
+	}
+	return index - 1, letters > 0
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	if f == nil {
+		return errors.New("missing part")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// XLSXWriter streams rows into a single-sheet workbook without holding them in memory.
+// Strings are written inline so the output reads back with ReadXLSX.
+type XLSXWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+var xlsxStaticParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// NewXLSXWriter starts a workbook on w; Close must be called to finish it
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxStaticParts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+
+	return &XLSXWriter{archive: archive, sheet: sheet}, nil
+}
+
+// WriteRow appends a row. Numbers become numeric cells, everything else is written as text.
+func (x *XLSXWriter) WriteRow(cells []interface{}) error {
+	x.rows++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, cell := range cells {
+		ref := columnName(i) + strconv.Itoa(x.rows)
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		default:
+			text := fmt.Sprint(v)
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&b, []byte(text))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+// Close finishes the sheet and the archive
+func (x *XLSXWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.archive.Close()
+}
+
+// columnName converts a zero-based column index to its letters (0 -> A, 26 -> AA)
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
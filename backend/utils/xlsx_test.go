@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXLSXRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := [][]interface{}{
+		{"name", "price", "qty"},
+		{"Teff <white> & co", 12.5, 3},
+		{"እንጀራ", nil, int64(7)},
+		{},
+		{"", "", "gap"},
+	}
+	for _, row := range input {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "price", "qty"},
+		{"Teff <white> & co", "12.5", "3"},
+		{"እንጀራ", "", "7"},
+		nil,
+		{"", "", "gap"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadXLSX = %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXSheets(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   map[string]string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "shared strings and rich text",
+			parts: map[string]string{
+				"xl/sharedStrings.xml": `<sst><si><t>plain</t></si><si><r><t>ri</t></r><r><t>ch</t></r></si></sst>`,
+				"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+					`<row r="3"><c r="B3"><v>4.25</v></c></row>`),
+			},
+			want: [][]string{{"plain", "", "rich"}, nil, {"", "4.25"}},
+		},
+		{
+			name:  "cells without references",
+			parts: map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row><c><v>1</v></c><c><v>2</v></c></row>`)},
+			want:  [][]string{{"1", "2"}},
+		},
+		{
+			name:  "last column",
+			parts: map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="XFD1"><v>1</v></c></row>`)},
+			want:  [][]string{append(make([]string, xlsxColumnLimit-1), "1")},
+		},
+		{
+			name:    "column past XFD",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="XFE1"><v>1</v></c></row>`)},
+			wantErr: true,
+		},
+		{
+			name:    "row past the sheet limit",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1048577"><c r="A1048577"><v>1</v></c></row>`)},
+			wantErr: true,
+		},
+		{
+			name:    "too many rows",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="50001"><c r="A50001"><v>1</v></c></row>`)},
+			wantErr: true,
+		},
+		{
+			name:    "row number zero",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="0"><c r="A1"><v>1</v></c></row>`)},
+			wantErr: true,
+		},
+		{
+			name:    "bad cell reference",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="12"><v>1</v></c></row>`)},
+			wantErr: true,
+		},
+		{
+			name: "too many cells",
+			parts: map[string]string{"xl/worksheets/sheet1.xml": sheetXML(
+				strings.Repeat(`<row><c r="XFD1"><v>1</v></c></row>`, maxXLSXCells/xlsxColumnLimit+1))},
+			wantErr: true,
+		},
+		{
+			name: "shared string out of range",
+			parts: map[string]string{
+				"xl/sharedStrings.xml":     `<sst><si><t>only</t></si></sst>`,
+				"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="s"><v>1</v></c></row>`),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no worksheet",
+			parts:   map[string]string{"xl/sharedStrings.xml": `<sst/>`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := zipParts(t, tt.parts)
+			got, err := ReadXLSX(bytes.NewReader(data), int64(len(data)))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidXLSX) {
+					t.Fatalf("err = %v, want ErrInvalidXLSX", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadXLSX = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXNotAZip(t *testing.T) {
+	data := []byte("name,price\nteff,12\n")
+	if _, err := ReadXLSX(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidXLSX) {
+		t.Errorf("err = %v, want ErrInvalidXLSX", err)
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref    string
+		want   int
+		wantOK bool
+	}{
+		{"A1", 0, true},
+		{"Z9", 25, true},
+		{"AA10", 26, true},
+		{"XFD1048576", xlsxColumnLimit - 1, true},
+		{"XFE1", 0, false},
+		{"AAAAAAAAAAAAAAAA1", 0, false},
+		{"1", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := columnIndex(tt.ref)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("columnIndex(%q) = %d, %v, want %d, %v", tt.ref, got, ok, tt.want, tt.wantOK)
+		}
+		if ok && columnName(got)+strings.TrimLeft(tt.ref, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != tt.ref {
+			t.Errorf("columnName(%d) does not give back %q", got, tt.ref)
+		}
+	}
+}
+
+func sheetXML(rows string) string {
+	return `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+// zipParts builds a minimal workbook; without workbook.xml the reader falls back to sheet1.xml
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
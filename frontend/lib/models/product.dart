@@ -9,6 +9,8 @@ class Product {
   final String? vendorId;
   final List<Variant> variants;
   final DateTime? createdAt;
+  // Bumped by the server on every edit; updates send it back as the If-Match ETag
+  final int? version;
 
   Product({
     required this.id,
@@ -19,8 +21,12 @@ class Product {
     this.vendorId,
     required this.variants,
     this.createdAt,
+    this.version,
   });
 
+  // The ETag the server sent for this version of the product
+  String? get etag => version != null ? '"$version"' : null;
+
   // Get the default variant (first one)
   Variant get defaultVariant => variants.isNotEmpty
       ? variants.first
@@ -54,6 +60,7 @@ class Product {
       createdAt: json['created_at'] != null
           ? DateTime.parse(json['created_at'])
           : null,
+      version: json['version'],
     );
   }
 
@@ -68,3 +75,23 @@ class Product {
     };
   }
 }
+
+// One page of the product listing; pass nextCursor back to fetch the following page
+class ProductPage {
+  final List<Product> products;
+  final String? nextCursor;
+
+  ProductPage({required this.products, this.nextCursor});
+
+  bool get hasMore => nextCursor != null;
+
+  factory ProductPage.fromJson(Map<String, dynamic> json) {
+    final nextCursor = json['next_cursor'] as String?;
+    return ProductPage(
+      products: (json['products'] as List<dynamic>? ?? [])
+          .map((p) => Product.fromJson(p))
+          .toList(),
+      nextCursor: nextCursor != null && nextCursor.isNotEmpty ? nextCursor : null,
+    );
+  }
+}
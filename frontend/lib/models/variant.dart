@@ -8,6 +8,8 @@ class Variant {
   final int quantity;
   final int? minStockLevel;
   final DateTime? createdAt;
+  // Bumped by the server on every edit; updates send it back as the If-Match ETag
+  final int? version;
 
   Variant({
     required this.id,
@@ -19,8 +21,12 @@ class Variant {
     required this.quantity,
     this.minStockLevel,
     this.createdAt,
+    this.version,
   });
 
+  // The ETag the server sent for this version of the variant
+  String? get etag => version != null ? '"$version"' : null;
+
   bool get isLowStock {
     if (minStockLevel == null) return false;
     return quantity <= minStockLevel!;
@@ -39,6 +45,7 @@ class Variant {
       createdAt: json['created_at'] != null
           ? DateTime.parse(json['created_at'])
           : null,
+      version: json['version'],
     );
   }
 
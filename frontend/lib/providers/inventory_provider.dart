@@ -9,6 +9,8 @@ class InventoryProvider with ChangeNotifier {
   List<Product> _products = [];
   List<Vendor> _vendors = [];
   bool _isLoading = false;
+  bool _isLoadingMore = false;
+  String? _nextCursor;
   String? _error;
   String? _searchQuery;
   String? _categoryFilter;
@@ -16,6 +18,8 @@ class InventoryProvider with ChangeNotifier {
   List<Product> get products => _products;
   List<Vendor> get vendors => _vendors;
   bool get isLoading => _isLoading;
+  bool get isLoadingMore => _isLoadingMore;
+  bool get hasMoreProducts => _nextCursor != null;
   String? get error => _error;
   String? get searchQuery => _searchQuery;
   String? get categoryFilter => _categoryFilter;
@@ -53,16 +57,19 @@ class InventoryProvider with ChangeNotifier {
 
   // ==================== PRODUCTS ====================
 
+  // Loads the first page of products; further pages come from loadMoreProducts as the user scrolls
   Future<void> loadProducts() async {
     _isLoading = true;
     _error = null;
     notifyListeners();
 
     try {
-      _products = await _inventoryService.getProducts(
+      final page = await _inventoryService.getProducts(
         search: _searchQuery,
         category: _categoryFilter,
       );
+      _products = page.products;
+      _nextCursor = page.nextCursor;
       _error = null;
     } catch (e) {
       _error = e.toString();
@@ -72,6 +79,32 @@ class InventoryProvider with ChangeNotifier {
     }
   }
 
+  Future<void> loadMoreProducts() async {
+    final cursor = _nextCursor;
+    if (cursor == null || _isLoading || _isLoadingMore) return;
+
+    _isLoadingMore = true;
+    notifyListeners();
+
+    try {
+      final page = await _inventoryService.getProducts(
+        search: _searchQuery,
+        category: _categoryFilter,
+        cursor: cursor,
+      );
+      // A refresh while this page was loading starts the listing over
+      if (cursor == _nextCursor) {
+        _products.addAll(page.products);
+        _nextCursor = page.nextCursor;
+      }
+    } catch (e) {
+      _error = e.toString();
+    } finally {
+      _isLoadingMore = false;
+      notifyListeners();
+    }
+  }
+
   Future<Product?> getProduct(String id) async {
     try {
       return await _inventoryService.getProduct(id);
@@ -182,6 +182,7 @@ class _ProductFormScreenState extends State<ProductFormScreen> {
         minStockLevel: _minStockController.text.isNotEmpty
             ? int.parse(_minStockController.text)
             : null,
+        version: _existingProduct?.variants.first.version,
       );
 
       // Create product
@@ -197,6 +198,7 @@ class _ProductFormScreenState extends State<ProductFormScreen> {
         imageUrl: uploadedImageUrl,
         vendorId: _selectedVendorId,
         variants: [variant],
+        version: _existingProduct?.version,
       );
 
       bool success;
@@ -166,9 +166,19 @@ class _ProductListScreenState extends State<ProductListScreen> {
 
                 return RefreshIndicator(
                   onRefresh: () => provider.loadProducts(),
-                  child: _isGridView
-                      ? _buildGridView(products)
-                      : _buildListView(products),
+                  child: NotificationListener<ScrollNotification>(
+                    // Fetch the next page before the user reaches the end
+                    onNotification: (notification) {
+                      if (notification.metrics.extentAfter < 600 &&
+                          provider.hasMoreProducts) {
+                        provider.loadMoreProducts();
+                      }
+                      return false;
+                    },
+                    child: _isGridView
+                        ? _buildGridView(products)
+                        : _buildListView(products),
+                  ),
                 );
               },
             ),
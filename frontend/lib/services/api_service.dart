@@ -52,9 +52,13 @@ class ApiService {
     String endpoint, {
     required Map<String, dynamic> body,
     bool requiresAuth = false,
+    Map<String, String>? extraHeaders,
   }) async {
     final url = Uri.parse('${AppConfig.apiBaseUrl}$endpoint');
     final headers = await _getHeaders(requiresAuth: requiresAuth);
+    if (extraHeaders != null) {
+      headers.addAll(extraHeaders);
+    }
 
     return await http.put(
       url,
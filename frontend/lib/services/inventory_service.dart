@@ -14,28 +14,32 @@ class InventoryService {
 
   // ==================== PRODUCTS ====================
 
-  Future<List<Product>> getProducts({
+  Future<ProductPage> getProducts({
     String? search,
     String? category,
+    String? cursor,
+    int limit = 50,
   }) async {
     try {
-      final queryParams = <String, String>{};
+      final queryParams = <String, String>{'limit': '$limit'};
       if (search != null && search.isNotEmpty) {
         queryParams['search'] = search;
       }
       if (category != null && category.isNotEmpty) {
         queryParams['category'] = category;
       }
+      if (cursor != null) {
+        queryParams['cursor'] = cursor;
+      }
 
       final response = await _api.get(
         '/products',
         requiresAuth: true,
-        queryParameters: queryParams.isNotEmpty ? queryParams : null,
+        queryParameters: queryParams,
       );
 
       if (response.statusCode == 200) {
-        final List<dynamic> data = jsonDecode(response.body);
-        return data.map((json) => Product.fromJson(json)).toList();
+        return ProductPage.fromJson(jsonDecode(response.body));
       } else {
         throw Exception('Failed to load products: ${response.body}');
       }
@@ -85,6 +89,7 @@ class InventoryService {
         '/products/$id',
         body: product.toJson(),
         requiresAuth: true,
+        extraHeaders: {'If-Match': product.etag ?? ''},
       );
 
       if (response.statusCode == 200) {
@@ -135,9 +140,10 @@ class InventoryService {
   Future<Variant> updateVariant(String productId, String variantId, Variant variant) async {
     try {
       final response = await _api.put(
-        '/products/$productId/variants/$variantId',
+        '/variants/$variantId',
         body: variant.toJson(),
         requiresAuth: true,
+        extraHeaders: {'If-Match': variant.etag ?? ''},
       );
 
       if (response.statusCode == 200) {